@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+// workerLimit parks workers while the remote is struggling. Every request
+// attempt takes a slot; once more than --remote-timeout-budget of the last
+// --remote-timeout-window attempts failed with a transport error, a timeout,
+// a 5xx or a 429, the slots are halved, and they are given back one at a time
+// while the failure rate stays below half the budget.
+type workerLimit struct {
+	mu       sync.Mutex
+	limit    int
+	active   int
+	min, max int
+	// changed is closed and replaced whenever a slot frees up or the limit grows.
+	changed chan struct{}
+	// recent is a ring of the last attempts, true for a failure.
+	recent   []bool
+	next     int
+	filled   int
+	failures int
+}
+
+// workerSlots is nil unless --remote-timeout-budget is set.
+var workerSlots *workerLimit
+
+func newWorkerLimit(threads int, window int) *workerLimit {
+	return &workerLimit{limit: threads, min: threads, max: threads, changed: make(chan struct{}), recent: make([]bool, window)}
+}
+
+// acquire waits for a free slot, returning false when ctx ends first.
+func (w *workerLimit) acquire(ctx context.Context) bool {
+	if w == nil {
+		return true
+	}
+	for {
+		w.mu.Lock()
+		if w.active < w.limit {
+			w.active++
+			w.mu.Unlock()
+			return true
+		}
+		changed := w.changed
+		w.mu.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// release frees the slot of an attempt and adapts the limit to its outcome.
+func (w *workerLimit) release(failed bool) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.active--
+	if w.recent[w.next] {
+		w.failures--
+	}
+	w.recent[w.next] = failed
+	if failed {
+		w.failures++
+	}
+	w.next = (w.next + 1) % len(w.recent)
+	if w.filled < len(w.recent) {
+		w.filled++
+	}
+	if w.filled == len(w.recent) {
+		rate := float64(w.failures) / float64(len(w.recent))
+		switch {
+		case rate > *remoteTimeoutBudget && w.limit > 1:
+			w.limit = (w.limit + 1) / 2
+			if w.limit < w.min {
+				w.min = w.limit
+			}
+			log.Printf("%.0f%% of the last %v requests failed, parking workers down to %v", 100*rate, len(w.recent), w.limit)
+			w.reset()
+		case rate < *remoteTimeoutBudget/2 && w.limit < w.max:
+			w.limit++
+			log.Printf("%.0f%% of the last %v requests failed, restoring workers up to %v", 100*rate, len(w.recent), w.limit)
+			w.reset()
+		}
+	}
+	close(w.changed)
+	w.changed = make(chan struct{})
+}
+
+// reset starts a new window, so the next change is judged on requests sent
+// with the limit just set.
+func (w *workerLimit) reset() {
+	w.next, w.filled, w.failures = 0, 0, 0
+	for i := range w.recent {
+		w.recent[i] = false
+	}
+}
+
+// reached returns the fewest and the most slots the run allowed.
+func (w *workerLimit) reached() (int, int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.min, w.max
+}
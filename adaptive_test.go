@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWorkerLimitHalvesAndRestores(t *testing.T) {
+	resetRun(t)
+	*remoteTimeoutBudget = 0.5
+	w := newWorkerLimit(8, 4)
+	attempts := func(failed ...bool) {
+		for _, f := range failed {
+			if !w.acquire(context.Background()) {
+				t.Fatal("no slot")
+			}
+			w.release(f)
+		}
+	}
+	// Half the window failing is within the budget.
+	attempts(true, false, true, false)
+	if w.limit != 8 {
+		t.Fatalf("limit %v within the budget, want 8", w.limit)
+	}
+	attempts(true, true, true, false)
+	attempts(true, true, true, true)
+	if w.limit != 2 {
+		t.Fatalf("limit %v after two failing windows, want 2", w.limit)
+	}
+	// Restored one slot per window below half the budget.
+	attempts(false, false, false, false, false, false, false, false)
+	if w.limit != 4 {
+		t.Errorf("limit %v after two clean windows, want 4", w.limit)
+	}
+	if fewest, most := w.reached(); fewest != 2 || most != 8 {
+		t.Errorf("reached %v to %v, want 2 to 8", fewest, most)
+	}
+
+	// A parked worker waits for a slot, or for its context to end.
+	for i := 0; i < 4; i++ {
+		w.acquire(context.Background())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if w.acquire(ctx) {
+		t.Error("a fifth worker got a slot out of 4")
+	}
+}
+
+func TestRemoteTimeoutBudgetParksWorkersUnderStress(t *testing.T) {
+	local, remote := t.TempDir(), t.TempDir()
+	mirrorTree(t, local, remote, 60)
+	tree := http.FileServer(http.Dir(remote))
+	var requests int64
+	var mu sync.Mutex
+	var inFlight, peakAfterSpike int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt64(&requests, 1)
+		// The first requests fail, then the remote recovers.
+		if n <= 30 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		mu.Lock()
+		inFlight++
+		if n > 40 && n <= 50 && inFlight > peakAfterSpike {
+			peakAfterSpike = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(2 * time.Millisecond)
+		tree.ServeHTTP(w, r)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+	}))
+	defer server.Close()
+	if err := runCrawler(t, "--maven-repository", local, "--nexus-root", server.URL, "--repository-name", "", "--no-preflight",
+		"--threads", "8", "--remote-timeout-budget", "0.3", "--remote-timeout-window", "10"); err != nil {
+		t.Fatal(err)
+	}
+	fewest, most := workerSlots.reached()
+	if fewest > 2 || most != 8 {
+		t.Errorf("workers ranged %v to %v, want down to 2 at most and up to 8", fewest, most)
+	}
+	if peakAfterSpike > 4 {
+		t.Errorf("%v requests in flight right after the spike, want the workers parked", peakAfterSpike)
+	}
+	if workerSlots.limit != 8 {
+		t.Errorf("%v workers at the end, want all 8 restored", workerSlots.limit)
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ageIndex keeps the newest and oldest mtime of every version of every local
+// artifact. Every repository group walks the tree again, which only sees the
+// same times again.
+type ageIndex struct {
+	mu       sync.Mutex
+	versions map[string]map[string]*versionAge
+}
+
+// versionAge spans the mtimes of the files of one version.
+type versionAge struct {
+	oldest, newest time.Time
+}
+
+var artifactAges = ageIndex{versions: map[string]map[string]*versionAge{}}
+
+// ageBuckets classify the artifacts by the age of their newest file, as of the
+// start of the run.
+var ageBuckets = []struct {
+	name  string
+	below time.Duration
+}{
+	{"under 30 days", 30 * 24 * time.Hour},
+	{"30 to 180 days", 180 * 24 * time.Hour},
+	{"180 days to 1 year", 365 * 24 * time.Hour},
+	{"1 to 2 years", 2 * 365 * 24 * time.Hour},
+	{"2 years or more", 0},
+}
+
+// ageReport is the layout of the --artifact-age-report file.
+type ageReport struct {
+	SchemaVersion int            `json:"schemaVersion"`
+	RunID         string         `json:"runId"`
+	Buckets       map[string]int `json:"buckets"`
+	// Artifacts are ordered stalest first.
+	Artifacts []artifactAge `json:"artifacts"`
+}
+
+// artifactAge is how recently any version of groupId:artifactId was written
+// locally. The times follow --time-format and --timezone.
+type artifactAge struct {
+	GroupID    string `json:"groupId"`
+	ArtifactID string `json:"artifactId"`
+	Versions   int    `json:"versions"`
+	// LatestVersion is the highest version by Maven ordering, LatestModified
+	// its newest file.
+	LatestVersion  string `json:"latestVersion"`
+	LatestModified string `json:"latestModified"`
+	Oldest         string `json:"oldest"`
+	Newest         string `json:"newest"`
+	AgeDays        int    `json:"ageDays"`
+	Bucket         string `json:"bucket"`
+	newest         time.Time
+}
+
+// add records the mtime of a walked file of the Maven layout. Sidecars,
+// signatures and metadata say nothing about the artifact itself.
+func (a *ageIndex) add(artifact LocalArtifact) {
+	if artifact.isDir || artifact.modTime.IsZero() {
+		return
+	}
+	g, ok := gavFromPath(artifact.path)
+	if !ok {
+		return
+	}
+	key := g.groupId + ":" + g.artifactId
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.versions[key] == nil {
+		a.versions[key] = map[string]*versionAge{}
+	}
+	v := a.versions[key][g.version]
+	if v == nil {
+		a.versions[key][g.version] = &versionAge{artifact.modTime, artifact.modTime}
+		return
+	}
+	if artifact.modTime.Before(v.oldest) {
+		v.oldest = artifact.modTime
+	}
+	if artifact.modTime.After(v.newest) {
+		v.newest = artifact.modTime
+	}
+}
+
+// report ages every artifact as of now and counts them per bucket.
+func (a *ageIndex) report(now time.Time) ageReport {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	report := ageReport{schemaVersion, repo.runID, map[string]int{}, []artifactAge{}}
+	for _, bucket := range ageBuckets {
+		report.Buckets[bucket.name] = 0
+	}
+	for key, versions := range a.versions {
+		coordinates := strings.SplitN(key, ":", 2)
+		age := artifactAge{GroupID: coordinates[0], ArtifactID: coordinates[1], Versions: len(versions)}
+		var oldest, newest time.Time
+		for version, v := range versions {
+			if age.LatestVersion == "" || compareVersions(version, age.LatestVersion) > 0 {
+				age.LatestVersion = version
+			}
+			if oldest.IsZero() || v.oldest.Before(oldest) {
+				oldest = v.oldest
+			}
+			if v.newest.After(newest) {
+				newest = v.newest
+			}
+		}
+		age.LatestModified = formatTime(versions[age.LatestVersion].newest)
+		age.Oldest, age.Newest, age.newest = formatTime(oldest), formatTime(newest), newest
+		elapsed := now.Sub(newest)
+		age.AgeDays = int(elapsed / (24 * time.Hour))
+		for _, bucket := range ageBuckets {
+			if bucket.below == 0 || elapsed < bucket.below {
+				age.Bucket = bucket.name
+				break
+			}
+		}
+		report.Buckets[age.Bucket]++
+		report.Artifacts = append(report.Artifacts, age)
+	}
+	sort.Slice(report.Artifacts, func(i, j int) bool {
+		if !report.Artifacts[i].newest.Equal(report.Artifacts[j].newest) {
+			return report.Artifacts[i].newest.Before(report.Artifacts[j].newest)
+		}
+		return report.Artifacts[i].GroupID+":"+report.Artifacts[i].ArtifactID < report.Artifacts[j].GroupID+":"+report.Artifacts[j].ArtifactID
+	})
+	return report
+}
+
+// compareVersions orders two Maven versions, roughly the way Maven does:
+// numeric parts compare as numbers, a release is above its qualified
+// versions, e.g. 1.10 > 1.9 > 1.9-beta and 1.0 > 1.0-SNAPSHOT.
+func compareVersions(a, b string) int {
+	split := func(v string) []string {
+		return strings.FieldsFunc(v, func(r rune) bool { return r == '.' || r == '-' })
+	}
+	as, bs := split(a), split(b)
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		if i >= len(as) {
+			return -qualifierOrder(bs[i])
+		}
+		if i >= len(bs) {
+			return qualifierOrder(as[i])
+		}
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if an != bn {
+				if an > bn {
+					return 1
+				}
+				return -1
+			}
+		case aErr == nil:
+			return 1
+		case bErr == nil:
+			return -1
+		default:
+			if c := strings.Compare(strings.ToLower(as[i]), strings.ToLower(bs[i])); c != 0 {
+				return c
+			}
+		}
+	}
+	return 0
+}
+
+// qualifierOrder tells how a version compares to the same one without the
+// extra part: a further number is above it, a qualifier below.
+func qualifierOrder(part string) int {
+	if _, err := strconv.Atoi(part); err == nil {
+		return 1
+	}
+	return -1
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestArtifactAgeBuckets(t *testing.T) {
+	local, out := t.TempDir(), t.TempDir()
+	day := 24 * time.Hour
+	ages := map[string]time.Duration{
+		"org/e/fresh/1.0/fresh-1.0.jar":     10 * day,
+		"org/e/fresh/1.0/fresh-1.0.pom":     40 * day,
+		"org/e/recent/2.0/recent-2.0.jar":   100 * day,
+		"org/e/aging/3.0/aging-3.0.jar":     200 * day,
+		"org/e/old/4.0/old-4.0.jar":         500 * day,
+		"org/e/stale/5.0/stale-5.0.jar":     1000 * day,
+		"org/e/stale/5.0/stale-5.0.jar.md5": 1 * day,
+		// The latest version by Maven ordering isn't the newest written.
+		"org/e/lib/1.9/lib-1.9.jar":   20 * day,
+		"org/e/lib/1.10/lib-1.10.jar": 300 * day,
+	}
+	now := time.Now()
+	for file, age := range ages {
+		writeTree(t, local, map[string]string{file: "content"})
+		if err := os.Chtimes(filepath.Join(local, file), now.Add(-age), now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reportFile := filepath.Join(out, "ages.json")
+	if err := runCrawler(t, "--maven-repository", local, "--local-only", "--artifact-age-report", reportFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeReports(); err != nil {
+		t.Fatal(err)
+	}
+	var report ageReport
+	readJSON(t, reportFile, &report)
+	wantBuckets := map[string]int{"under 30 days": 2, "30 to 180 days": 1, "180 days to 1 year": 1, "1 to 2 years": 1, "2 years or more": 1}
+	if !reflect.DeepEqual(report.Buckets, wantBuckets) {
+		t.Errorf("buckets = %v, want %v", report.Buckets, wantBuckets)
+	}
+	// Stalest first, the checksum file doesn't freshen stale.
+	var order []string
+	for _, a := range report.Artifacts {
+		order = append(order, a.ArtifactID)
+	}
+	if want := []string{"stale", "old", "aging", "recent", "lib", "fresh"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("artifacts ordered %v, want %v", order, want)
+	}
+	for _, a := range report.Artifacts {
+		if a.ArtifactID == "lib" && (a.Versions != 2 || a.LatestVersion != "1.10" || a.AgeDays != 20) {
+			t.Errorf("lib ages %+v, want 2 versions, 1.10 the latest, 20 days old", a)
+		}
+		if a.ArtifactID == "fresh" && a.AgeDays != 10 {
+			t.Errorf("fresh ages %+v, want the jar's 10 days", a)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	for _, test := range []struct {
+		a, b string
+		want int
+	}{
+		{"1.10", "1.9", 1},
+		{"1.9", "1.9-beta", 1},
+		{"1.0", "1.0-SNAPSHOT", 1},
+		{"1.0.1", "1.0", 1},
+		{"2.0-alpha", "2.0-BETA", -1},
+		{"1.0", "1.0", 0},
+	} {
+		if got := compareVersions(test.a, test.b); got != test.want {
+			t.Errorf("compareVersions(%v, %v) = %v, want %v", test.a, test.b, got, test.want)
+		}
+		if got := compareVersions(test.b, test.a); got != -test.want {
+			t.Errorf("compareVersions(%v, %v) = %v, want %v", test.b, test.a, got, -test.want)
+		}
+	}
+}
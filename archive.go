@@ -0,0 +1,235 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// archiveEntry is a file or directory of an --archive, open yields its content.
+type archiveEntry struct {
+	name    string
+	isDir   bool
+	size    int64
+	modTime time.Time
+	open    func() (io.ReadCloser, error)
+}
+
+// validateArchive makes sure --archive is a zip or tar file this can read.
+func validateArchive(file string) error {
+	if archiveFormat(file) == "" {
+		return fmt.Errorf("--archive %v must be a .zip, .jar, .tar, .tar.gz or .tgz file", file)
+	}
+	if _, err := os.Stat(file); err != nil {
+		return fmt.Errorf("--archive %v cannot be read: %v", file, err)
+	}
+	return nil
+}
+
+func archiveFormat(file string) string {
+	name := strings.ToLower(file)
+	switch {
+	case strings.HasSuffix(name, ".zip") || strings.HasSuffix(name, ".jar"):
+		return "zip"
+	case strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tgz"):
+		return "tgz"
+	case strings.HasSuffix(name, ".tar"):
+		return "tar"
+	}
+	return ""
+}
+
+// walkArchive calls visit for every file and directory entry of the archive,
+// in archive order. Tar entries are streamed, their content is only readable
+// during the visit.
+func walkArchive(file string, visit func(archiveEntry) error) error {
+	if archiveFormat(file) == "zip" {
+		z, err := zip.OpenReader(file)
+		if err != nil {
+			return err
+		}
+		defer z.Close()
+		for _, f := range z.File {
+			if err := visit(archiveEntry{f.Name, f.FileInfo().IsDir(), int64(f.UncompressedSize64), f.Modified, f.Open}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	input, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+	var r io.Reader = input
+	if archiveFormat(file) == "tgz" {
+		gz, err := gzip.NewReader(input)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeDir {
+			continue
+		}
+		open := func() (io.ReadCloser, error) { return ioutil.NopCloser(tr), nil }
+		if err := visit(archiveEntry{header.Name, header.Typeflag == tar.TypeDir, header.Size, header.ModTime, open}); err != nil {
+			return err
+		}
+	}
+}
+
+// archiveArtifacts walks the entries of an --archive as if it were the
+// exploded local tree, hashing every file from its entry reader without
+// extracting anything. Files are emitted as they are read, the directories and
+// the versions listed only in maven-metadata.xml once the whole archive is
+// known, as entries may come in any order.
+func archiveArtifacts(done <-chan struct{}, file string, prefix string) (<-chan LocalArtifact, <-chan error) {
+	artifacts := make(chan LocalArtifact)
+	errs := make(chan error, 1)
+	prefix = path.Clean(filepath.ToSlash(prefix))
+	go func() {
+		defer close(artifacts)
+		want := neededDigests()
+		emit := func(a LocalArtifact) error {
+			a.root = file
+			select {
+			case artifacts <- a:
+				return nil
+			case <-done:
+				return errors.New("Scan cancelled ...")
+			}
+		}
+		// dirs maps every directory seen to whether it holds files and subdirectories.
+		type dirContent struct{ hasFiles, hasSubdirs bool }
+		dirs := map[string]*dirContent{}
+		// metadataFiles are the maven-metadata.xml read for --follow-metadata.
+		type metadataFile struct {
+			path    string
+			content []byte
+		}
+		var metadataFiles []metadataFile
+		addDir := func(dir string) *dirContent {
+			if dirs[dir] == nil {
+				dirs[dir] = &dirContent{}
+			}
+			return dirs[dir]
+		}
+		walkErr := walkArchive(file, func(entry archiveEntry) error {
+			name := path.Clean(strings.TrimPrefix(entry.name, "./"))
+			if name == "." || !underPrefix(name, prefix) {
+				return nil
+			}
+			if entry.isDir {
+				addDir(name)
+			}
+			for child, dir := name, path.Dir(name); underPrefix(dir, prefix); child, dir = dir, path.Dir(dir) {
+				parent := addDir(dir)
+				if child == name && !entry.isDir {
+					parent.hasFiles = true
+				} else {
+					parent.hasSubdirs = true
+				}
+				if dir == "." {
+					break
+				}
+			}
+			if entry.isDir || entry.modTime.Before(sinceTime) {
+				return nil
+			}
+			artifact := LocalArtifact{path: filepath.FromSlash(name), size: entry.size, modTime: entry.modTime}
+			var content []byte
+			artifact.err = readEntry(entry, func(r io.Reader) error {
+				var err error
+				if *followMetadata && path.Base(name) == metadataFileName {
+					if content, err = ioutil.ReadAll(r); err != nil {
+						return err
+					}
+					r = bytes.NewReader(content)
+				}
+				artifact.checksums, err = hashReader(r, wantedFor(name, want))
+				return err
+			})
+			if *dedupeIdenticalFiles != "" && artifact.err == nil {
+				artifact.root = file
+				identicalFiles.add(artifact)
+			}
+			if *artifactAgeReport != "" && artifact.err == nil {
+				artifactAges.add(artifact)
+			}
+			if err := emit(artifact); err != nil {
+				return err
+			}
+			if artifact.err == nil && content != nil {
+				metadataFiles = append(metadataFiles, metadataFile{artifact.path, content})
+			}
+			return nil
+		})
+		// Only the whole archive tells which listed versions are absent.
+		inArchive := func(dir string) bool { return dirs[path.Clean(filepath.ToSlash(dir))] != nil }
+		for _, m := range metadataFiles {
+			if walkErr != nil {
+				break
+			}
+			for _, a := range metadataVersionArtifacts(m.path, m.content, inArchive) {
+				if walkErr = emit(a); walkErr != nil {
+					break
+				}
+			}
+		}
+		if walkErr == nil {
+			names := make([]string, 0, len(dirs))
+			for name := range dirs {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				d := dirs[name]
+				dir := LocalArtifact{path: filepath.FromSlash(name), isDir: true, emptyDir: !d.hasFiles && !d.hasSubdirs, leafDir: !d.hasSubdirs}
+				if walkErr = emit(dir); walkErr != nil {
+					break
+				}
+			}
+		}
+		errs <- walkErr
+	}()
+	return artifacts, errs
+}
+
+// underPrefix tells whether the slash separated name is prefix or beneath it,
+// everything is with the "." prefix.
+func underPrefix(name string, prefix string) bool {
+	return prefix == "." || name == prefix || strings.HasPrefix(name, prefix+"/")
+}
+
+// readEntry opens the entry and hands its content to read.
+func readEntry(entry archiveEntry, read func(io.Reader) error) error {
+	r, err := entry.open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return read(r)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// archiveFixture is a small repository, the remote lacks the pom.
+var archiveFixture = map[string]string{
+	"org/e/lib/1.0/lib-1.0.jar": "jar content",
+	"org/e/lib/1.0/lib-1.0.pom": "<project/>",
+}
+
+func writeZip(t *testing.T, file string, files map[string]string) {
+	t.Helper()
+	out, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	z := zip.NewWriter(out)
+	for name, content := range files {
+		w, err := z.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := z.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeTgz packs the files alone, without directory entries.
+func writeTgz(t *testing.T, file string, files map[string]string) {
+	t.Helper()
+	out, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	gz := gzip.NewWriter(out)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: "./" + name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestArchiveIsCheckedLikeTheTree(t *testing.T) {
+	remote, out := t.TempDir(), t.TempDir()
+	writeTree(t, remote, map[string]string{
+		"org/e/lib/1.0/lib-1.0.jar":     "jar content",
+		"org/e/lib/1.0/lib-1.0.jar.md5": md5Hex("jar content"),
+	})
+	server, _ := serveTree(t, remote)
+	for _, archive := range []struct {
+		name  string
+		write func(*testing.T, string, map[string]string)
+	}{{"repository.zip", writeZip}, {"repository.tgz", writeTgz}} {
+		file := filepath.Join(out, archive.name)
+		archive.write(t, file, archiveFixture)
+		if err := runCrawler(t, "--archive", file, "--nexus-root", server.URL, "--repository-name", "", "--md5Sum"); err != nil {
+			t.Fatal(err)
+		}
+		lost := append(append([]string{}, repo.lostDirs...), repo.lostFiles...)
+		// The root, org, org/e, org/e/lib, the version and its two files.
+		if checkedCount() != 7 || !reflect.DeepEqual(lost, []string{server.URL + "/org/e/lib/1.0/lib-1.0.pom"}) {
+			t.Errorf("%v: %v checked, lost %v", archive.name, checkedCount(), lost)
+		}
+		// The jar was hashed from its entry and matches the remote .md5.
+		if got := findingPaths(categoryChecksumMismatch); len(got) != 0 {
+			t.Errorf("%v: checksum mismatches %v", archive.name, got)
+		}
+	}
+}
+
+func TestValidateArchive(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "repository.zip")
+	if err := validateArchive(file); err == nil {
+		t.Error("a missing archive was accepted")
+	}
+	writeZip(t, file, archiveFixture)
+	if err := validateArchive(file); err != nil {
+		t.Error(err)
+	}
+	if err := validateArchive(filepath.Join(filepath.Dir(file), "repository.rar")); err == nil {
+		t.Error("a .rar archive was accepted")
+	}
+}
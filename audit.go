@@ -0,0 +1,24 @@
+package main
+
+import "flag"
+
+// auditFlags are the checks --full-audit turns on.
+var auditFlags = []string{"md5Sum", "sha1Sum", "verify-size", "verify-content-type", "verify-content-type-map", "follow-metadata", "local-checks"}
+
+// applyFullAudit turns on every check of auditFlags that wasn't given on the
+// command line or in the environment, so a single one can still be left out.
+// --local-checks needs a local tree, it is left off for --archive and --gav.
+func applyFullAudit() {
+	explicit := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+	for _, name := range auditFlags {
+		if name == "local-checks" && (*archivePath != "" || checkingGAVs()) {
+			continue
+		}
+		if !explicit[name] {
+			flag.Set(name, "true")
+		}
+	}
+}
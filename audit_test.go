@@ -0,0 +1,102 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestFullAuditPopulatesEveryCategory(t *testing.T) {
+	local := t.TempDir()
+	pom := "<project><groupId>org.e</groupId><artifactId>lib</artifactId><version>1.0</version></project>"
+	metadata := "<metadata><versioning><versions><version>1.0</version><version>9.9</version></versions></versioning></metadata>"
+	writeTree(t, local, map[string]string{
+		"org/e/lib/maven-metadata.xml":   metadata,
+		"org/e/lib/1.0/lib-1.0.jar":      "jar content",
+		"org/e/lib/1.0/lib-1.0.jar.sha1": sha1Hex("older content"),
+		"org/e/lib/1.0/lib-1.0.pom":      pom,
+		"org/e/lib/1.0/other-1.0.jar":    "other",
+		"org/e/lib/2.0/lib-2.0.jar":      "jar content",
+		"org/e/lib/3.0/lib-3.0.jar":      "",
+		"org/e/lib/4.0/lib-4.0.pom":      "<project",
+		"org/e/lib/5.0/lib-5.0.jar.sha1": sha1Hex("jar content"),
+	})
+	type served struct{ content, contentType string }
+	remote := map[string]served{
+		"/org/e/lib/maven-metadata.xml":      {metadata, "application/xml"},
+		"/org/e/lib/1.0/lib-1.0.jar":         {"jar content", "application/java-archive"},
+		"/org/e/lib/1.0/lib-1.0.jar.md5":     {md5Hex("newer content"), "text/plain"},
+		"/org/e/lib/1.0/lib-1.0.jar.sha1":    {sha1Hex("jar content"), "text/plain"},
+		"/org/e/lib/1.0/lib-1.0.pom":         {pom, "application/octet-stream"},
+		"/org/e/lib/1.0/lib-1.0.pom.md5":     {md5Hex(pom), "text/plain"},
+		"/org/e/lib/1.0/other-1.0.jar":       {"other", "application/java-archive"},
+		"/org/e/lib/1.0/other-1.0.jar.md5":   {md5Hex("other"), "text/plain"},
+		"/org/e/lib/1.0/other-1.0.jar.sha1":  {sha1Hex("other"), "text/plain"},
+		"/org/e/lib/2.0/lib-2.0.jar":         {"<html><body>Sign in</body></html>", "text/html"},
+		"/org/e/lib/3.0/lib-3.0.jar":         {"", "application/java-archive"},
+		"/org/e/lib/4.0/lib-4.0.pom":         {"<project", "application/xml"},
+		"/org/e/lib/5.0/lib-5.0.jar.sha1":    {sha1Hex("jar content"), "text/plain"},
+		"/org/e/lib/maven-metadata.xml.md5":  {md5Hex(metadata), "text/plain"},
+		"/org/e/lib/maven-metadata.xml.sha1": {sha1Hex(metadata), "text/plain"},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if file, ok := remote[r.URL.Path]; ok {
+			w.Header().Set("Content-Type", file.contentType)
+			w.Header().Set("Content-Length", strconv.Itoa(len(file.content)))
+			if r.Method != http.MethodHead {
+				w.Write([]byte(file.content))
+			}
+			return
+		}
+		for path := range remote {
+			if strings.HasPrefix(path, strings.TrimSuffix(r.URL.Path, "/")+"/") {
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				return
+			}
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+	// --full-audit leaves the checks given explicitly alone, and the flag
+	// package remembers every flag set by the runs of earlier tests as given:
+	// each run gets a process of its own.
+	audit := func(args ...string) missingReport {
+		t.Helper()
+		missingFile := filepath.Join(t.TempDir(), "missing.json")
+		args = append([]string{"--maven-repository", local, "--nexus-root", server.URL, "--repository-name", "", "--full-audit",
+			"--json", "--json-file", missingFile}, args...)
+		if code, output := runMain(t, args...); code == 1 {
+			t.Fatalf("run failed: %v", output)
+		}
+		var missing missingReport
+		readJSON(t, missingFile, &missing)
+		return missing
+	}
+	missing := audit()
+	var got []string
+	for category := range missing.Findings {
+		got = append(got, category)
+	}
+	sort.Strings(got)
+	for _, category := range []string{
+		categoryChecksumMismatch, categoryMissingSidecar, categorySizeMismatch, categoryHTMLPage, categoryContentType,
+		categoryMetadataVersion, categoryZeroByte, categoryInvalidPom, categoryNonCanonicalPath, categoryOrphanChecksum, categoryLocalChecksum,
+	} {
+		if len(missing.Findings[category]) == 0 {
+			t.Errorf("no %v finding, the categories found are %v", category, got)
+		}
+	}
+	if got := missing.Findings[categoryInvalidPom]; len(got) != 1 || got[0].Path != "org/e/lib/4.0/lib-4.0.pom" {
+		t.Errorf("invalid-pom findings = %v", got)
+	}
+
+	// A check given explicitly stays as given.
+	missing = audit("--follow-metadata=false")
+	if len(missing.Findings[categoryChecksumMismatch]) == 0 || len(missing.Findings[categoryMetadataVersion]) != 0 {
+		t.Errorf("--full-audit --follow-metadata=false findings: %v", missing.Findings)
+	}
+}
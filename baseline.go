@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+)
+
+// baselineState is what the --baseline run reported about one artifact.
+type baselineState struct {
+	lost       bool
+	categories map[string]bool
+}
+
+// baselineResults holds the artifacts the --baseline run reported lost or
+// with findings, keyed by baselineKey. Artifacts it doesn't hold were present
+// and clean.
+var baselineResults map[string]*baselineState
+
+// Changes since the --baseline run, counted for the summary.
+var newlyLost, newlyMismatched, recovered int
+
+// loadBaseline reads the lost artifacts and the findings of a previous --json
+// report.
+func loadBaseline(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("Cannot read --baseline: %v", err)
+	}
+	var previous missingReport
+	if err := json.Unmarshal(content, &previous); err != nil {
+		return fmt.Errorf("--baseline %v is not a --json report: %v", path, err)
+	}
+	baselineResults = map[string]*baselineState{}
+	state := func(artifactURL string) *baselineState {
+		key := baselineKey(artifactURL)
+		if baselineResults[key] == nil {
+			baselineResults[key] = &baselineState{categories: map[string]bool{}}
+		}
+		return baselineResults[key]
+	}
+	for _, lost := range append(previous.LostDirs, previous.LostFiles...) {
+		state(lost).lost = true
+	}
+	for category, findings := range previous.Findings {
+		for _, f := range findings {
+			state(f.Path).categories[category] = true
+		}
+	}
+	return nil
+}
+
+// resultCategories are the finding categories of r, its outcome included when
+// that is a finding itself, e.g. forbidden.
+func resultCategories(r Result, outcome string) map[string]bool {
+	categories := map[string]bool{}
+	for _, f := range r.findings {
+		categories[f.category] = true
+	}
+	if _, ok := categorySeverity[outcome]; ok {
+		categories[outcome] = true
+	}
+	return categories
+}
+
+// changedSinceBaseline tells whether r was lost in the baseline run and no
+// longer is, or the other way round, or its finding categories differ from
+// the baseline ones. Without --baseline everything counts as changed. Only the
+// per-artifact output is narrowed to the changes, the --json report stays
+// complete so it can be the baseline of the next run.
+func changedSinceBaseline(r Result, outcome string) bool {
+	if baselineResults == nil {
+		return true
+	}
+	previous := baselineResults[baselineKey(r.path)]
+	if previous == nil {
+		previous = &baselineState{}
+	}
+	if previous.lost != (outcome == outcomeLost) {
+		return true
+	}
+	categories := resultCategories(r, outcome)
+	if len(categories) != len(previous.categories) {
+		return true
+	}
+	for category := range categories {
+		if !previous.categories[category] {
+			return true
+		}
+	}
+	return false
+}
+
+// baselineKey keys an artifact URL on its path only, so a baseline taken
+// against another host of the same layout still compares.
+func baselineKey(artifactURL string) string {
+	if u, err := url.Parse(artifactURL); err == nil {
+		return u.Path
+	}
+	return artifactURL
+}
+
+// countChange records r in the change counts of the summary: lost now, with a
+// finding the baseline didn't have, or present and clean again.
+func countChange(r Result, outcome string) {
+	if baselineResults == nil || !changedSinceBaseline(r, outcome) {
+		return
+	}
+	if outcome == outcomeLost {
+		newlyLost++
+		return
+	}
+	previous := baselineResults[baselineKey(r.path)]
+	for category := range resultCategories(r, outcome) {
+		if previous == nil || !previous.categories[category] {
+			newlyMismatched++
+			return
+		}
+	}
+	if outcome == outcomePresent {
+		recovered++
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestBaselineOutputsOnlyTheChanges(t *testing.T) {
+	local, remote, out := t.TempDir(), t.TempDir(), t.TempDir()
+	mirrorTree(t, local, remote, 4)
+	sidecars := map[string]string{}
+	for _, version := range []string{"1", "2", "3"} {
+		sidecars["org/e/lib/"+version+"/lib-"+version+".jar.md5"] = md5Hex("jar content")
+		sidecars["org/e/lib/"+version+"/lib-"+version+".pom.md5"] = md5Hex("<project/>")
+	}
+	writeTree(t, remote, sidecars)
+	server, _ := serveTree(t, remote)
+	baselineFile := filepath.Join(out, "baseline.json")
+	if err := runCrawler(t, "--maven-repository", local, "--nexus-root", server.URL, "--repository-name", "",
+		"--md5Sum", "--json", "--json-file", baselineFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeReports(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The version 0 comes back, a pom goes missing and a jar changes.
+	writeTree(t, remote, map[string]string{
+		"org/e/lib/0/lib-0.jar":     "jar content",
+		"org/e/lib/0/lib-0.jar.md5": md5Hex("jar content"),
+		"org/e/lib/0/lib-0.pom":     "<project/>",
+		"org/e/lib/0/lib-0.pom.md5": md5Hex("<project/>"),
+		"org/e/lib/2/lib-2.jar.md5": md5Hex("newer content"),
+	})
+	if err := os.Remove(filepath.Join(remote, "org/e/lib/1/lib-1.pom")); err != nil {
+		t.Fatal(err)
+	}
+	args := []string{"--maven-repository", local, "--nexus-root", server.URL, "--repository-name", "",
+		"--md5Sum", "--baseline", baselineFile}
+	_, output := runMain(t, append(args, "--line-template", "LINE {{.RelPath}} {{.Outcome}}")...)
+	var got []string
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, "LINE ") {
+			got = append(got, line)
+		}
+	}
+	sort.Strings(got)
+	want := []string{
+		"LINE org/e/lib/0 present",
+		"LINE org/e/lib/0/lib-0.jar present",
+		"LINE org/e/lib/0/lib-0.pom present",
+		"LINE org/e/lib/1/lib-1.pom lost",
+		"LINE org/e/lib/2/lib-2.jar present",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("changed lines %q, want %q", got, want)
+	}
+
+	if err := runCrawler(t, args...); err != nil {
+		t.Fatal(err)
+	}
+	if newlyLost != 1 || newlyMismatched != 1 || recovered != 3 {
+		t.Errorf("%v newly lost, %v newly mismatched, %v recovered", newlyLost, newlyMismatched, recovered)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+)
+
+// batchReporter logs a partial summary every --batch-summary-interval, a
+// number of checked artifacts or a duration. It runs on the collector, so it
+// reads the repo buckets without locking.
+type batchReporter struct {
+	every    int
+	interval time.Duration
+	started  time.Time
+	last     time.Time
+	checked  int
+}
+
+// newBatchReporter parses --batch-summary-interval: an artifact count such as
+// 1000 or a duration such as 30s.
+func newBatchReporter(value string) (*batchReporter, error) {
+	now := time.Now()
+	if n, err := strconv.Atoi(value); err == nil && n > 0 {
+		return &batchReporter{every: n, started: now, last: now}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil && d > 0 {
+		return &batchReporter{interval: d, started: now, last: now}, nil
+	}
+	return nil, fmt.Errorf("--batch-summary-interval %v is neither a positive count nor a duration", value)
+}
+
+var batches *batchReporter
+
+func (b *batchReporter) result(r Result, outcome string) {
+	b.checked++
+	now := time.Now()
+	if b.every > 0 && b.checked%b.every != 0 {
+		return
+	}
+	if b.interval > 0 && now.Sub(b.last) < b.interval {
+		return
+	}
+	b.last = now
+	rate := float64(b.checked) / now.Sub(b.started).Seconds()
+	log.Printf("Partial summary: %v checked, %v present, %v lost dirs, %v lost files, %v findings, %.1f artifacts/s, %v",
+		b.checked, repo.present, len(repo.lostDirs), len(repo.lostFiles), countFindings(), rate, progress())
+}
+
+func countFindings() int {
+	n := 0
+	for _, findings := range repo.findings {
+		n += len(findings)
+	}
+	return n
+}
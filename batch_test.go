@@ -0,0 +1,33 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestBatchSummaryCadence(t *testing.T) {
+	local, remote := t.TempDir(), t.TempDir()
+	// The root, org, org/e, org/e/lib and 5 versions with 2 files: 19 checks.
+	mirrorTree(t, local, remote, 5)
+	server, _ := serveTree(t, remote)
+	_, output := runMain(t, "--maven-repository", local, "--nexus-root", server.URL, "--repository-name", "",
+		"--batch-summary-interval", "5")
+	partial := regexp.MustCompile(`Partial summary: (\d+) checked`)
+	var checked []string
+	for _, match := range partial.FindAllStringSubmatch(output, -1) {
+		checked = append(checked, match[1])
+	}
+	if strings.Join(checked, ",") != "5,10,15" {
+		t.Errorf("partial summaries after %v checks, want 5, 10 and 15, output %q", checked, output)
+	}
+
+	for _, value := range []string{"0", "-3", "often", "-1s"} {
+		if _, err := newBatchReporter(value); err == nil {
+			t.Errorf("--batch-summary-interval %v was accepted", value)
+		}
+	}
+	if b, err := newBatchReporter("30s"); err != nil || b.interval.Seconds() != 30 || b.every != 0 {
+		t.Errorf("--batch-summary-interval 30s = %+v, %v", b, err)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Outcomes of a result that --only-categories accepts besides the finding
+// categories.
+const (
+	outcomePresent      = "present"
+	outcomeLost         = "lost"
+	outcomeWrongContent = "wrong-content"
+)
+
+// onlyCategories holds --only-categories, empty when every category is output.
+var onlyCategories = map[string]bool{}
+
+// parseOnlyCategories reads --only-categories, rejecting unknown names so a
+// typo doesn't silently empty the output.
+func parseOnlyCategories(value string) error {
+	for _, category := range strings.Split(value, ",") {
+		if category = strings.TrimSpace(category); category == "" {
+			continue
+		}
+		if _, ok := categorySeverity[category]; !ok && category != outcomePresent && category != outcomeLost && category != outcomeWrongContent {
+			return fmt.Errorf("--only-categories: unknown category %v", category)
+		}
+		onlyCategories[category] = true
+	}
+	return nil
+}
+
+// categorySelected tells whether output about any of categories passes
+// --only-categories.
+func categorySelected(categories ...string) bool {
+	if len(onlyCategories) == 0 {
+		return true
+	}
+	for _, category := range categories {
+		if onlyCategories[category] {
+			return true
+		}
+	}
+	return false
+}
+
+// filteredReporter passes on the results --only-categories selects, by their
+// outcome or one of their findings, that changed since --baseline. The repo
+// buckets and so the summary still count every result.
+type filteredReporter struct {
+	next reporter
+}
+
+func (f filteredReporter) result(r Result, outcome string) {
+	if !changedSinceBaseline(r, outcome) {
+		return
+	}
+	if categorySelected(outcome) {
+		f.next.result(r, outcome)
+		return
+	}
+	for _, finding := range r.findings {
+		if categorySelected(finding.category) {
+			f.next.result(r, outcome)
+			return
+		}
+	}
+}
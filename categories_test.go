@@ -0,0 +1,43 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestOnlyCategoriesFocusesTheReportNotTheCounts(t *testing.T) {
+	local, remote, out := t.TempDir(), t.TempDir(), t.TempDir()
+	mirrorTree(t, local, remote, 3)
+	writeTree(t, remote, map[string]string{"org/e/lib/1/lib-1.jar.md5": md5Hex("older content")})
+	server, _ := serveTree(t, remote)
+	missingFile := filepath.Join(out, "missing.json")
+	if err := runCrawler(t, "--maven-repository", local, "--nexus-root", server.URL, "--repository-name", "",
+		"--md5Sum", "--only-categories", categoryChecksumMismatch, "--json", "--json-file", missingFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeReports(); err != nil {
+		t.Fatal(err)
+	}
+	var missing missingReport
+	readJSON(t, missingFile, &missing)
+	if len(missing.LostDirs) != 0 || len(missing.LostFiles) != 0 || len(missing.Findings) != 1 || len(missing.Findings[categoryChecksumMismatch]) != 1 {
+		t.Errorf("focused report lost %v %v, findings %v", missing.LostDirs, missing.LostFiles, missing.Findings)
+	}
+	// The version 0 and its two files are lost all the same.
+	if checkedCount() != 4+3*3 || len(repo.lostDirs) != 1 || len(repo.lostFiles) != 2 {
+		t.Errorf("%v checked, lost %v %v", checkedCount(), repo.lostDirs, repo.lostFiles)
+	}
+}
+
+func TestParseOnlyCategories(t *testing.T) {
+	resetRun(t)
+	if err := parseOnlyCategories("lost, checksum-mismatch,"); err != nil {
+		t.Fatal(err)
+	}
+	if !categorySelected(outcomePresent, outcomeLost) || !categorySelected(categoryChecksumMismatch) || categorySelected(outcomePresent) {
+		t.Errorf("selected %v", onlyCategories)
+	}
+	if err := parseOnlyCategories("lsot"); err == nil {
+		t.Error("a misspelled category was accepted")
+	}
+}
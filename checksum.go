@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// normalizeChecksum lowercases and trims the content of a checksum file. With
+// --normalize-checksum-case it also drops the filename that md5sum/sha1sum
+// style files append after the hash ("<hash>  <filename>").
+func normalizeChecksum(raw string) string {
+	checksum := strings.ToLower(strings.TrimSpace(raw))
+	if *normalizeChecksumCase {
+		if fields := strings.Fields(checksum); len(fields) > 0 {
+			checksum = fields[0]
+		}
+	}
+	return checksum
+}
+
+// checksumsEqual compares a checksum read from a sidecar with a computed one.
+func checksumsEqual(expected string, computed string) bool {
+	return normalizeChecksum(expected) == normalizeChecksum(computed)
+}
+
+// sidecar pairs a checksum file extension with the locally computed digest.
+// remote is the checksum when it is already known without fetching the
+// sidecar, as from an MD5 ETag.
+type sidecar struct {
+	ext      string
+	computed string
+	remote   string
+}
+
+// maxSidecarSize bounds how much of a remote checksum file is read.
+const maxSidecarSize = 1024
+
+// verifyRemoteChecksums compares the enabled remote sidecars of url with the
+// local digests of artifact. By default every enabled checksum has to match;
+// with --any-checksum-ok the first match is enough and the remaining sidecars
+// aren't fetched.
+func verifyRemoteChecksums(ctx context.Context, client *http.Client, url string, artifact LocalArtifact, etag string) []remoteFinding {
+	if isChecksumFile(artifact.path) {
+		return nil
+	}
+	var sidecars []sidecar
+	if etag != "" {
+		// The ETag stands in for the .md5 sidecar, sparing its request.
+		sidecars = append(sidecars, sidecar{"ETag", artifact.md5, etag})
+	} else if *md5Sum {
+		sidecars = append(sidecars, sidecar{".md5", artifact.md5, ""})
+	}
+	if *sha1Sum {
+		sidecars = append(sidecars, sidecar{".sha1", artifact.sha1, ""})
+	}
+	if checksumAlgorithms["sha256"] {
+		sidecars = append(sidecars, sidecar{".sha256", artifact.sha256, ""})
+	}
+	if checksumAlgorithms["sha512"] {
+		sidecars = append(sidecars, sidecar{".sha512", artifact.sha512, ""})
+	}
+
+	var findings []remoteFinding
+	for _, sidecar := range sidecars {
+		remote := sidecar.remote
+		if remote == "" {
+			var err error
+			if remote, err = fetchSidecar(ctx, client, url+sidecar.ext); err != nil {
+				findings = append(findings, remoteFinding{categoryMissingSidecar, err.Error()})
+				continue
+			}
+		}
+		if checksumsEqual(remote, sidecar.computed) {
+			if *anyChecksumOk {
+				return nil
+			}
+			continue
+		}
+		findings = append(findings, remoteFinding{categoryChecksumMismatch,
+			fmt.Sprintf("remote %v is %v, computed %v", sidecar.ext, normalizeChecksum(remote), sidecar.computed)})
+	}
+	return findings
+}
+
+// md5ETag matches an ETag that is a plain hex MD5 of the content.
+var md5ETag = regexp.MustCompile(`^[0-9a-fA-F]{32}$`)
+
+// etagMD5 returns the ETag of resp when it looks like the MD5 of the content.
+// Weak ETags and multipart upload ETags ("<md5>-<parts>") aren't content
+// digests and are ignored.
+func etagMD5(resp *http.Response) string {
+	etag := resp.Header.Get("ETag")
+	if strings.HasPrefix(etag, "W/") {
+		return ""
+	}
+	etag = strings.Trim(etag, `"`)
+	if !md5ETag.MatchString(etag) {
+		return ""
+	}
+	return strings.ToLower(etag)
+}
+
+func fetchSidecar(ctx context.Context, client *http.Client, url string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%v answered %v", url, resp.Status)
+	}
+	content, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxSidecarSize))
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
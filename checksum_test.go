@@ -0,0 +1,135 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestChecksumsEqualFormats(t *testing.T) {
+	resetRun(t)
+	computed := md5Hex("jar content")
+	upper := "E275A06031E75C3BD254012A9127E9C1"
+	for _, test := range []struct {
+		sidecar   string
+		normalize bool
+		want      bool
+	}{
+		{computed, false, true},
+		{upper, false, true},
+		{" " + computed + "\n", false, true},
+		{computed + "  lib-1.0.jar", false, false},
+		{computed + "  lib-1.0.jar", true, true},
+		{upper + " *lib-1.0.jar\n", true, true},
+		{md5Hex("other content"), true, false},
+	} {
+		*normalizeChecksumCase = test.normalize
+		if got := checksumsEqual(test.sidecar, computed); got != test.want {
+			t.Errorf("checksumsEqual(%q) with --normalize-checksum-case=%v = %v, want %v", test.sidecar, test.normalize, got, test.want)
+		}
+	}
+}
+
+func TestAnyChecksumOkPolicies(t *testing.T) {
+	local, remote := t.TempDir(), t.TempDir()
+	writeTree(t, local, map[string]string{"org/e/lib/1.0/lib-1.0.jar": "jar content"})
+	writeTree(t, remote, map[string]string{
+		"org/e/lib/1.0/lib-1.0.jar":      "jar content",
+		"org/e/lib/1.0/lib-1.0.jar.md5":  md5Hex("jar content"),
+		"org/e/lib/1.0/lib-1.0.jar.sha1": sha1Hex("other content"),
+	})
+	server, requests := serveTree(t, remote)
+	args := []string{"--maven-repository", local, "--nexus-root", server.URL, "--repository-name", "", "--md5Sum", "--sha1Sum"}
+
+	if err := runCrawler(t, args...); err != nil {
+		t.Fatal(err)
+	}
+	if got := findingPaths(categoryChecksumMismatch); len(got) != 1 {
+		t.Errorf("every checksum must match by default, checksum-mismatch findings = %v", got)
+	}
+	allRequests := atomic.LoadInt64(requests)
+
+	atomic.StoreInt64(requests, 0)
+	if err := runCrawler(t, append(args, "--any-checksum-ok")...); err != nil {
+		t.Fatal(err)
+	}
+	if got := findingPaths(categoryChecksumMismatch); len(got) != 0 {
+		t.Errorf("the matching .md5 should do with --any-checksum-ok, checksum-mismatch findings = %v", got)
+	}
+	if n := atomic.LoadInt64(requests); n != allRequests-1 {
+		t.Errorf("--any-checksum-ok sent %v requests, want the .sha1 fewer than %v", n, allRequests)
+	}
+}
+
+func TestETagAsMD5(t *testing.T) {
+	local := t.TempDir()
+	writeTree(t, local, map[string]string{
+		"org/e/lib/1.0/lib-1.0.jar":         "jar content",
+		"org/e/lib/1.0/lib-1.0.pom":         "<project/>",
+		"org/e/lib/1.0/lib-1.0-sources.jar": "sources",
+		"org/e/lib/1.0/lib-1.0-javadoc.jar": "javadoc",
+	})
+	var sidecars int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, ".md5"):
+			atomic.AddInt64(&sidecars, 1)
+		case strings.HasSuffix(r.URL.Path, "lib-1.0.jar"):
+			w.Header().Set("ETag", `"`+strings.ToUpper(md5Hex("jar content"))+`"`)
+		case strings.HasSuffix(r.URL.Path, ".pom"):
+			w.Header().Set("ETag", `"`+md5Hex("other content")+`"`)
+		case strings.HasSuffix(r.URL.Path, "-sources.jar"):
+			w.Header().Set("ETag", `W/"`+md5Hex("other content")+`"`)
+		case strings.HasSuffix(r.URL.Path, "-javadoc.jar"):
+			w.Header().Set("ETag", `"`+md5Hex("other content")+`-3"`)
+		}
+	}))
+	defer server.Close()
+	if err := runCrawler(t, "--maven-repository", local, "--nexus-root", server.URL, "--repository-name", "", "--etag-as-md5"); err != nil {
+		t.Fatal(err)
+	}
+	// The weak and the multipart ETags aren't digests of the content.
+	want := []string{server.URL + "/org/e/lib/1.0/lib-1.0.pom"}
+	if got := findingPaths(categoryChecksumMismatch); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("checksum-mismatch findings = %v, want %v", got, want)
+	}
+	if sidecars != 0 {
+		t.Errorf("%v .md5 sidecars were requested besides the ETags", sidecars)
+	}
+}
+
+func TestSHA256AndSHA512Sidecars(t *testing.T) {
+	local, remote := t.TempDir(), t.TempDir()
+	files := map[string]string{
+		"org/e/lib/1.0/lib-1.0.jar": "jar content",
+		"org/e/lib/2.0/lib-2.0.jar": "jar content",
+		"org/e/lib/3.0/lib-3.0.jar": "jar content",
+	}
+	writeTree(t, local, files)
+	writeTree(t, remote, files)
+	sha256Sum, sha512Sum := sha256.Sum256([]byte("jar content")), sha512.Sum512([]byte("jar content"))
+	otherSum := sha256.Sum256([]byte("other content"))
+	writeTree(t, remote, map[string]string{
+		"org/e/lib/1.0/lib-1.0.jar.sha256": hex.EncodeToString(sha256Sum[:]),
+		"org/e/lib/1.0/lib-1.0.jar.sha512": hex.EncodeToString(sha512Sum[:]),
+		"org/e/lib/2.0/lib-2.0.jar.sha256": hex.EncodeToString(otherSum[:]),
+		"org/e/lib/2.0/lib-2.0.jar.sha512": hex.EncodeToString(sha512Sum[:]),
+		"org/e/lib/3.0/lib-3.0.jar.sha256": hex.EncodeToString(sha256Sum[:]),
+	})
+	server, _ := serveTree(t, remote)
+	if err := runCrawler(t, "--maven-repository", local, "--nexus-root", server.URL, "--repository-name", "",
+		"--checksum", "sha256,sha512"); err != nil {
+		t.Fatal(err)
+	}
+	if got := findingPaths(categoryChecksumMismatch); len(got) != 1 || !strings.HasSuffix(got[0], "/lib-2.0.jar") {
+		t.Errorf("checksum-mismatch findings = %v, want the jar with another .sha256", got)
+	}
+	if got := findingPaths(categoryMissingSidecar); len(got) != 1 || !strings.HasSuffix(got[0], "/lib-3.0.jar") {
+		t.Errorf("missing-sidecar findings = %v, want the jar without a .sha512", got)
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// reporter receives every classified result along with its outcome, e.g.
+// "present", "lost" or a finding category.
+type reporter interface {
+	result(r Result, outcome string)
+}
+
+// logReporter prints every result under --verbose.
+type logReporter struct{}
+
+func (logReporter) result(r Result, outcome string) {
+	if !*verbose || r.fromMetadata {
+		return
+	}
+	if len(r.redirects) > 0 {
+		log.Printf("artifact: %v redirected %d times: %v", r.path, len(r.redirects), strings.Join(r.redirects, " -> "))
+	}
+	switch outcome {
+	case outcomeWrongContent:
+		log.Printf("artifact: %v status: %v wrong content", r.path, r.status)
+	case categoryForbidden:
+		log.Printf("File %v is forbidden. Code: %v", r.path, r.code)
+	case outcomeLost:
+		if r.isDir {
+			log.Printf("Dir %v is lost. Code: %v vs %v", r.path, r.code, dirsAcceptable)
+		} else {
+			log.Printf("File %v is lost. Code: %v vs %v", r.path, r.code, fileAcceptable)
+		}
+	default:
+		if r.mirror != "" {
+			log.Printf("artifact: %v status: %v from mirror %v", r.path, r.status, r.mirror)
+			return
+		}
+		log.Printf("artifact: %v status: %v", r.path, r.status)
+	}
+}
+
+// repoMu serializes the collectors writing the repo buckets, which only
+// matters when --group-concurrency checks several groups at once.
+var repoMu sync.Mutex
+
+// setGroupStatus records how far group was checked.
+func (r *Repository) setGroupStatus(group string, status string) {
+	repoMu.Lock()
+	defer repoMu.Unlock()
+	r.groupStatus[group] = status
+}
+
+// collector owns the repo buckets while a group is checked. The workers only
+// send results, the collector classifies them one at a time and fans them out
+// to the reporters.
+type collector struct {
+	group     string
+	reporters []reporter
+	// stalled is set once --stall-timeout cancelled the group.
+	stalled bool
+}
+
+func newCollector(group string) *collector {
+	c := &collector{group: group, reporters: []reporter{filteredReporter{logReporter{}}}}
+	if events != nil {
+		c.reporters = append(c.reporters, filteredReporter{events})
+	}
+	if batches != nil {
+		// The partial summaries count everything, like the final one.
+		c.reporters = append(c.reporters, batches)
+	}
+	if lines != nil {
+		c.reporters = append(c.reporters, filteredReporter{lines})
+	}
+	return c
+}
+
+// collect classifies results until res is closed. On the first error it
+// cancels the group but keeps draining, so no worker is left blocked and every
+// result sent before the failure is accounted for. With --stall-timeout the
+// group is cancelled as well once no result arrived for that long, so a hung
+// worker can't stall the run forever.
+func (c *collector) collect(ctx context.Context, cancel context.CancelFunc, res <-chan Result) <-chan error {
+	collected := make(chan error, 1)
+	go func() {
+		var failed error
+		var stall <-chan time.Time
+		var watchdog *time.Timer
+		if *stallTimeout > 0 {
+			watchdog = time.NewTimer(*stallTimeout)
+			defer watchdog.Stop()
+			stall = watchdog.C
+		}
+		for {
+			var r Result
+			var ok bool
+			select {
+			case r, ok = <-res:
+			case <-stall:
+				log.Printf("No result for %v in group %q, cancelling it to force progress", *stallTimeout, c.group)
+				c.stalled = true
+				stall = nil
+				cancel()
+				continue
+			}
+			if !ok {
+				break
+			}
+			if stall != nil {
+				watchdog.Reset(*stallTimeout)
+			}
+			if failed == nil {
+				failed = c.handle(ctx, cancel, r)
+			}
+		}
+		collected <- failed
+	}()
+	return collected
+}
+
+// handle classifies r and reports it, holding repoMu. It returns the error
+// that failed the group, if any.
+func (c *collector) handle(ctx context.Context, cancel context.CancelFunc, r Result) error {
+	repoMu.Lock()
+	defer repoMu.Unlock()
+	if !r.fromMetadata {
+		atomic.AddInt64(&walked, 1)
+	}
+	if ctx.Err() != nil {
+		// The deadline, a stall or a failure cut whatever is still in flight short.
+		repo.notChecked++
+		return nil
+	}
+	outcome, err := c.classify(r)
+	if err != nil {
+		cancel()
+		return err
+	}
+	if outcome == "" {
+		return nil
+	}
+	countChange(r, outcome)
+	for _, rep := range c.reporters {
+		rep.result(r, outcome)
+	}
+	return nil
+}
+
+// classify files r into the repo buckets and returns its outcome, empty for
+// results that were never checked remotely.
+func (c *collector) classify(r Result) (string, error) {
+	// Every group walks the same tree, local findings are recorded once.
+	localFindings := c.group == repoGroups[0]
+	if r.emptyDir && localFindings {
+		repo.addFinding(categoryEmptyDir, localPath(r.root, r.relPath), "directory has no files, possibly an interrupted copy")
+	}
+	if r.localErr != nil {
+		if localFindings {
+			repo.addFinding(categoryLocalReadError, localPath(r.root, r.relPath), r.localErr.Error())
+		}
+		return "", nil
+	}
+	local := LocalArtifact{root: r.root, path: r.relPath, size: r.size, checksums: r.checksums}
+	if localFindings && !r.isDir && !r.fromMetadata && !isDownloadMarker(local) {
+		if *localChecks {
+			checkLocalArtifact(local)
+		} else if *checkLocalChecksums && !isChecksumFile(r.relPath) {
+			checkLocalSidecars(local)
+		}
+	}
+	if r.skipped {
+		if localFindings && isDownloadMarker(LocalArtifact{path: r.relPath}) {
+			repo.addFinding(categoryDownloadMarker, localPath(r.root, r.relPath), "leftover of an interrupted download")
+		}
+		if r.trusted && localFindings {
+			repo.trusted++
+		}
+		return "", nil
+	}
+	if errors.Is(r.err, context.Canceled) {
+		// Cut short rather than failed, the artifact simply wasn't checked.
+		repo.notChecked++
+		return "", nil
+	}
+	if isTimeout(r.err) && *timeoutAs == "lost" {
+		// The group is still running, so this is the request timing out
+		// rather than the group deadline.
+		r.status, r.err = "timeout", nil
+	}
+	if r.err != nil {
+		return "", r.err
+	}
+	if r.compareErr != nil {
+		return "", r.compareErr
+	}
+	repo.account(r)
+	if len(r.redirects) > 0 {
+		repo.redirectChains[r.path] = r.redirects
+	}
+	for _, f := range r.findings {
+		repo.addFinding(f.category, r.path, f.detail)
+	}
+	if r.fromMetadata {
+		if !isPresent(r.code, r.isDir) {
+			repo.addFinding(categoryMetadataVersion, r.path, "listed in maven-metadata.xml, remote answered "+r.status)
+			return categoryMetadataVersion, nil
+		}
+		return outcomePresent, nil
+	}
+	outcome := outcomePresent
+	if r.hasFinding(categoryTypeMismatch) || r.hasFinding(categoryHTMLPage) {
+		outcome = outcomeWrongContent
+	} else if isPresent(r.code, r.isDir) || (r.isForbiddenFile() && *forbiddenIsOk) {
+		repo.present++
+		if !*boundedMemory {
+			repo.healthy = append(repo.healthy, r)
+		}
+		if r.mirror != "" {
+			repo.servedBy[r.mirror]++
+		}
+		if len(repoGroups) > 1 && !r.isDir && !*boundedMemory {
+			repo.presentIn[r.relPath] = append(repo.presentIn[r.relPath], r.group)
+		}
+	} else if r.isForbiddenFile() {
+		repo.addFinding(categoryForbidden, r.path, r.status)
+		outcome = categoryForbidden
+	} else {
+		outcome = outcomeLost
+		if r.isDir {
+			repo.lostDirs = append(repo.lostDirs, r.path)
+		} else {
+			repo.lostFiles = append(repo.lostFiles, r.path)
+			if len(mavenRoots) > 1 {
+				repo.lostByRoot[r.root] = append(repo.lostByRoot[r.root], r.path)
+			}
+			repo.lostSizes[r.path] = r.size
+		}
+	}
+	repo.countExtension(r, outcome == outcomeLost)
+	if checkingGAVs() && repo.gavOutcomes[r.relPath] != outcomePresent {
+		repo.gavOutcomes[r.relPath] = outcome
+	}
+	if *reconcileFile != "" {
+		repo.reconcileResult(r, outcome)
+	}
+	if *compareRemote != "" && isPresent(r.code, r.isDir) != isPresent(r.compareCode, r.isDir) {
+		repo.addFinding(categoryMirrorMismatch, r.path,
+			fmt.Sprintf("%v here, %v on %v", r.status, r.compareStatus, *compareRemote))
+	}
+	return outcome, nil
+}
+
+// isTimeout tells whether err is a request or connection timing out, once any
+// retries are exhausted.
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout())
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEveryResultIsAccountedForUnderLoad(t *testing.T) {
+	local, remote := t.TempDir(), t.TempDir()
+	const versions = 200
+	mirrorTree(t, local, remote, versions)
+	for v := 7; v < versions; v += 7 {
+		if err := os.Remove(filepath.Join(remote, fmt.Sprintf("org/e/lib/%[1]v/lib-%[1]v.jar", v))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tree := http.FileServer(http.Dir(remote))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Enough latency for the results to arrive out of order.
+		time.Sleep(time.Duration(len(r.URL.Path)%5) * time.Millisecond)
+		tree.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	if err := runCrawler(t, "--maven-repository", local, "--nexus-root", server.URL, "--repository-name", "", "--threads", "64"); err != nil {
+		t.Fatal(err)
+	}
+	// The root, org, org/e and org/e/lib, and every version with its 2 files.
+	const checked = 4 + versions*3
+	if walked != checked || checkedCount() != checked {
+		t.Errorf("walked %v and checked %v, want %v", walked, checkedCount(), checked)
+	}
+	lostJars := (versions - 1) / 7
+	if len(repo.lostDirs) != 1 || len(repo.lostFiles) != 2+lostJars {
+		t.Errorf("lost %v dirs and %v files, want 1 and %v", len(repo.lostDirs), len(repo.lostFiles), 2+lostJars)
+	}
+	if repo.present+len(repo.lostDirs)+len(repo.lostFiles) != checked {
+		t.Errorf("%v present and %v lost don't add up to %v", repo.present, len(repo.lostDirs)+len(repo.lostFiles), checked)
+	}
+}
+
+func TestStallTimeoutCancelsAHungWorker(t *testing.T) {
+	local, remote := t.TempDir(), t.TempDir()
+	mirrorTree(t, local, remote, 5)
+	tree := http.FileServer(http.Dir(remote))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/org/e/lib/3/lib-3.jar" {
+			// Hangs until the crawler gives up on it.
+			<-r.Context().Done()
+			return
+		}
+		tree.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	start := time.Now()
+	if err := runCrawler(t, "--maven-repository", local, "--nexus-root", server.URL, "--repository-name", "",
+		"--stall-timeout", "300ms", "--threads", "4"); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("the run took %v despite the 300ms stall timeout", elapsed)
+	}
+	if status := repo.groupStatus[""]; status != "partial, stalled for 300ms" {
+		t.Errorf("group status = %q", status)
+	}
+	if len(repo.lostFiles) != 2 {
+		t.Errorf("lost %v, want the files of version 0 only", repo.lostFiles)
+	}
+}
+
+func TestCancelledChecksAreNotChecked(t *testing.T) {
+	local, remote := t.TempDir(), t.TempDir()
+	mirrorTree(t, local, remote, 3)
+	tree := http.FileServer(http.Dir(remote))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/org/e/lib/2/lib-2.jar" {
+			<-r.Context().Done()
+			return
+		}
+		tree.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	missingFile := filepath.Join(t.TempDir(), "missing.json")
+	if err := runCrawler(t, "--maven-repository", local, "--nexus-root", server.URL, "--repository-name", "",
+		"--group-deadline", "300ms", "--json", "--json-file", missingFile); err != nil {
+		t.Fatalf("a cancelled check failed the scan: %v", err)
+	}
+	if err := writeReports(); err != nil {
+		t.Fatal(err)
+	}
+	var missing missingReport
+	readJSON(t, missingFile, &missing)
+	if missing.NotChecked != 1 {
+		t.Errorf("%v not checked, want the jar cut short by the deadline", missing.NotChecked)
+	}
+	// Only version 0 is really lost.
+	if len(missing.LostFiles) != 2 || strings.Contains(strings.Join(missing.LostFiles, " "), "lib-2.jar") {
+		t.Errorf("lost files = %v", missing.LostFiles)
+	}
+	if repo.present+len(repo.lostDirs)+len(repo.lostFiles)+repo.notChecked != 4+3*3 {
+		t.Errorf("%v present, %v lost and %v not checked don't add up to every artifact", repo.present, len(repo.lostDirs)+len(repo.lostFiles), repo.notChecked)
+	}
+}
+
+// groupTracker serves the trees of the repository groups a and b, recording
+// the requests in flight in all and whether the groups were ever checked at
+// the same time.
+type groupTracker struct {
+	mu          sync.Mutex
+	inFlight    map[string]int
+	maxInFlight int
+	overlapped  bool
+}
+
+func (g *groupTracker) serve(t *testing.T, remote string) *httptest.Server {
+	files := http.FileServer(http.Dir(remote))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		group := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)[0]
+		g.mu.Lock()
+		g.inFlight[group]++
+		total := 0
+		for other, n := range g.inFlight {
+			total += n
+			if other != group && n > 0 {
+				g.overlapped = true
+			}
+		}
+		if total > g.maxInFlight {
+			g.maxInFlight = total
+		}
+		g.mu.Unlock()
+		time.Sleep(2 * time.Millisecond)
+		files.ServeHTTP(w, r)
+		g.mu.Lock()
+		g.inFlight[group]--
+		g.mu.Unlock()
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestGroupConcurrency(t *testing.T) {
+	local, remote := t.TempDir(), t.TempDir()
+	mirrorTree(t, local, filepath.Join(remote, "a"), 10)
+	mirrorTree(t, local, filepath.Join(remote, "b"), 10)
+	for _, concurrency := range []string{"1", "2"} {
+		tracker := &groupTracker{inFlight: map[string]int{}}
+		server := tracker.serve(t, remote)
+		if err := runCrawler(t, "--maven-repository", local, "--nexus-root", server.URL, "--repository-name", "a,b",
+			"--no-preflight", "--threads", "4", "--group-concurrency", concurrency); err != nil {
+			t.Fatal(err)
+		}
+		if checkedCount() != 2*(4+10*3) || len(repo.lostDirs) != 2 {
+			t.Errorf("--group-concurrency %v: %v checked, lost %v", concurrency, checkedCount(), repo.lostDirs)
+		}
+		if tracker.overlapped != (concurrency != "1") {
+			t.Errorf("--group-concurrency %v: groups checked at the same time: %v", concurrency, tracker.overlapped)
+		}
+		// The workers are split between the groups, not multiplied.
+		if tracker.maxInFlight > 4 {
+			t.Errorf("--group-concurrency %v: %v requests in flight, --threads is 4", concurrency, tracker.maxInFlight)
+		}
+	}
+}
+
+func TestBoundedMemoryKeepsOnlyCounts(t *testing.T) {
+	local, remote := t.TempDir(), t.TempDir()
+	mirrorTree(t, local, remote, 20)
+	server, _ := serveTree(t, remote)
+	if err := runCrawler(t, "--maven-repository", local, "--nexus-root", server.URL, "--repository-name", "", "--bounded-memory"); err != nil {
+		t.Fatal(err)
+	}
+	if len(repo.healthy) != 0 {
+		t.Errorf("--bounded-memory kept %v healthy results", len(repo.healthy))
+	}
+	// The 19 present versions with their 2 files each, and the root, org, org/e
+	// and org/e/lib.
+	if repo.present != 19*3+4 {
+		t.Errorf("present = %v, want %v", repo.present, 19*3+4)
+	}
+	if len(repo.lostDirs) != 1 || len(repo.lostFiles) != 2 {
+		t.Errorf("lost %v dirs and %v files, want 1 and 2", repo.lostDirs, repo.lostFiles)
+	}
+}
+
+// BenchmarkBoundedMemory compares the heap a check of a tree leaves in use,
+// which is what grows with the tree, with and without --bounded-memory.
+func BenchmarkBoundedMemory(b *testing.B) {
+	local, remote := b.TempDir(), b.TempDir()
+	mirrorTree(b, local, remote, 2000)
+	server, _ := serveTree(b, remote)
+	for _, bench := range []struct {
+		name  string
+		flags []string
+	}{
+		{"unbounded", nil},
+		{"bounded", []string{"--bounded-memory"}},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			var retained uint64
+			for i := 0; i < b.N; i++ {
+				resetState()
+				var before, after runtime.MemStats
+				runtime.GC()
+				runtime.ReadMemStats(&before)
+				args := append([]string{"--maven-repository", local, "--nexus-root", server.URL, "--repository-name", ""}, bench.flags...)
+				if err := runCrawler(b, args...); err != nil {
+					b.Fatal(err)
+				}
+				runtime.GC()
+				runtime.ReadMemStats(&after)
+				if after.HeapAlloc > before.HeapAlloc {
+					retained += after.HeapAlloc - before.HeapAlloc
+				}
+			}
+			b.ReportMetric(float64(retained)/float64(b.N), "retained-B/op")
+		})
+	}
+}
+
+func TestTimeoutAs(t *testing.T) {
+	local, remote := t.TempDir(), t.TempDir()
+	mirrorTree(t, local, remote, 3)
+	tree := http.FileServer(http.Dir(remote))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".jar") {
+			<-r.Context().Done()
+			return
+		}
+		tree.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	args := []string{"--maven-repository", local, "--nexus-root", server.URL, "--repository-name", "",
+		"--request-timeout", "50ms", "--max-retries", "1"}
+
+	if err := runCrawler(t, append(args, "--timeout-as", "error")...); err == nil || !isTimeout(err) {
+		t.Errorf("--timeout-as error: run ended with %v, want a timeout", err)
+	}
+
+	if err := runCrawler(t, append(args, "--timeout-as", "lost")...); err != nil {
+		t.Fatal(err)
+	}
+	// The version 0 the remote lacks, and every jar as it times out.
+	var jars int
+	for _, lost := range repo.lostFiles {
+		if strings.HasSuffix(lost, ".jar") {
+			jars++
+		}
+	}
+	if checkedCount() != 4+3*3 || len(repo.lostDirs) != 1 || len(repo.lostFiles) != 4 || jars != 3 {
+		t.Errorf("--timeout-as lost: %v checked, lost %v %v", checkedCount(), repo.lostDirs, repo.lostFiles)
+	}
+	if repo.byStatus["timeout"].Requests != 3 {
+		t.Errorf("--timeout-as lost: statuses %v, want the 3 jars timed out", repo.byStatus)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// binaryExtensions are artifact types a remote must never answer with HTML.
+var binaryExtensions = map[string]bool{
+	".jar": true, ".war": true, ".ear": true, ".aar": true, ".rar": true,
+	".zip": true, ".tar": true, ".gz": true, ".tgz": true, ".bz2": true, ".xz": true,
+	".so": true, ".dll": true, ".exe": true, ".class": true,
+}
+
+func isBinaryPath(path string) bool {
+	return binaryExtensions[strings.ToLower(filepath.Ext(path))]
+}
+
+// sniffLength is how many bytes http.DetectContentType considers.
+const sniffLength = 512
+
+// verifyContent flags a binary artifact that the remote answers with an HTML
+// page, as captive proxies and SSO gateways do with a 200. A text/html
+// Content-Type is conclusive; a missing or other text/* type is settled by
+// sniffing the first bytes of the body.
+func verifyContent(ctx context.Context, client *http.Client, url string, artifact LocalArtifact, resp *http.Response) []remoteFinding {
+	if !*verifyContentType || artifact.isDir || resp.StatusCode != http.StatusOK || !isBinaryPath(artifact.path) {
+		return nil
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if contentType != "" && !strings.HasPrefix(contentType, "text/") {
+		return nil
+	}
+	if !strings.HasPrefix(contentType, "text/html") {
+		sniffed, err := sniffContentType(ctx, client, url)
+		if err != nil {
+			return nil
+		}
+		contentType = sniffed
+	}
+	if strings.HasPrefix(contentType, "text/html") {
+		return []remoteFinding{{categoryHTMLPage, fmt.Sprintf("binary artifact is served as %v, likely a login or interstitial page", contentType)}}
+	}
+	return nil
+}
+
+// sniffContentType fetches the first bytes of url and detects their type.
+func sniffContentType(ctx context.Context, client *http.Client, url string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", sniffLength-1))
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	buf := make([]byte, sniffLength)
+	n, err := io.ReadFull(resp.Body, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	return http.DetectContentType(buf[:n]), nil
+}
+
+// expectedContentTypes maps extensions to the media types a correctly
+// configured remote serves them with. --content-type-map extends or overrides it.
+var expectedContentTypes = map[string][]string{
+	".jar":    {"application/java-archive", "application/x-java-archive"},
+	".war":    {"application/java-archive", "application/x-java-archive"},
+	".ear":    {"application/java-archive", "application/x-java-archive"},
+	".pom":    {"application/xml", "text/xml"},
+	".xml":    {"application/xml", "text/xml"},
+	".zip":    {"application/zip"},
+	".json":   {"application/json"},
+	".md5":    {"text/plain"},
+	".sha1":   {"text/plain"},
+	".sha256": {"text/plain"},
+	".sha512": {"text/plain"},
+	".asc":    {"text/plain", "application/pgp-signature"},
+}
+
+// parseContentTypeMap applies --content-type-map entries of the form
+// .ext=type[|type...], separated by commas, on top of the defaults.
+func parseContentTypeMap(value string) error {
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || !strings.HasPrefix(parts[0], ".") || parts[1] == "" {
+			return fmt.Errorf("--content-type-map entry %q is not .ext=type[|type...]", entry)
+		}
+		expectedContentTypes[strings.ToLower(parts[0])] = strings.Split(parts[1], "|")
+	}
+	return nil
+}
+
+// verifySize flags a file whose remote length differs from the local size,
+// read from the Content-Range total of a ranged probe. Artifacts without a
+// local file and remotes not announcing a length are not judged.
+func verifySize(artifact LocalArtifact, resp *http.Response) []remoteFinding {
+	if !*verifySizeFlag || artifact.isDir || artifact.fromMetadata || checkingGAVs() || resp.StatusCode != http.StatusOK {
+		return nil
+	}
+	remote := resp.ContentLength
+	if headUnsupported {
+		contentRange := resp.Header.Get("Content-Range")
+		total, err := strconv.ParseInt(contentRange[strings.LastIndex(contentRange, "/")+1:], 10, 64)
+		if err != nil {
+			return nil
+		}
+		remote = total
+	}
+	if remote < 0 || remote == artifact.size {
+		return nil
+	}
+	return []remoteFinding{{categorySizeMismatch, fmt.Sprintf("%v bytes remotely, %v locally", remote, artifact.size)}}
+}
+
+// verifyContentTypeMapping flags a file served with a Content-Type other than
+// the ones expected for its extension. Extensions without an expectation and
+// responses without a Content-Type are not judged.
+func verifyContentTypeMapping(artifact LocalArtifact, resp *http.Response) []remoteFinding {
+	if !*verifyContentTypeMap || artifact.isDir || resp.StatusCode != http.StatusOK {
+		return nil
+	}
+	expected, ok := expectedContentTypes[strings.ToLower(filepath.Ext(artifact.path))]
+	contentType := resp.Header.Get("Content-Type")
+	if !ok || contentType == "" {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = contentType
+	}
+	for _, e := range expected {
+		if strings.EqualFold(mediaType, e) {
+			return nil
+		}
+	}
+	return []remoteFinding{{categoryContentType, fmt.Sprintf("served as %v, expected %v", mediaType, strings.Join(expected, " or "))}}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestVerifyContentTypeFlagsHTMLPages(t *testing.T) {
+	local := t.TempDir()
+	writeTree(t, local, map[string]string{
+		"org/e/lib/1.0/lib-1.0.jar":         "PK\x03\x04 jar content",
+		"org/e/lib/1.0/lib-1.0-sources.jar": "PK\x03\x04 sources",
+		"org/e/lib/1.0/lib-1.0-javadoc.jar": "PK\x03\x04 javadoc",
+	})
+	const login = "<!DOCTYPE html><html><body><form action=/login></form></body></html>"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "-sources.jar"):
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(login))
+		case strings.HasSuffix(r.URL.Path, "-javadoc.jar"):
+			// Not conclusive, the body has to be sniffed.
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte(login))
+		case strings.HasSuffix(r.URL.Path, ".jar"):
+			w.Header().Set("Content-Type", "application/java-archive")
+			w.Write([]byte("PK\x03\x04 jar content"))
+		}
+	}))
+	defer server.Close()
+	if err := runCrawler(t, "--maven-repository", local, "--nexus-root", server.URL, "--repository-name", "", "--verify-content-type"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{server.URL + "/org/e/lib/1.0/lib-1.0-javadoc.jar", server.URL + "/org/e/lib/1.0/lib-1.0-sources.jar"}
+	if got := findingPaths(categoryHTMLPage); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("html-page findings = %v, want %v", got, want)
+	}
+	if !hasFailures() {
+		t.Error("HTML served for binaries should fail the run")
+	}
+}
+
+func TestVerifyContentTypeMapFlagsWrongTypes(t *testing.T) {
+	defaults := map[string][]string{}
+	for ext, types := range expectedContentTypes {
+		defaults[ext] = types
+	}
+	t.Cleanup(func() { expectedContentTypes = defaults })
+
+	local := t.TempDir()
+	writeTree(t, local, map[string]string{
+		"org/e/lib/1.0/lib-1.0.jar":         "jar content",
+		"org/e/lib/1.0/lib-1.0-sources.jar": "sources",
+		"org/e/lib/1.0/lib-1.0.pom":         "<project/>",
+		"org/e/lib/1.0/lib-1.0.module":      "{}",
+	})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "-sources.jar"):
+			w.Header().Set("Content-Type", "application/java-archive")
+		case strings.HasSuffix(r.URL.Path, ".jar"):
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		case strings.HasSuffix(r.URL.Path, ".pom"):
+			w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+		default:
+			w.Header().Set("Content-Type", "application/octet-stream")
+		}
+	}))
+	defer server.Close()
+	args := []string{"--maven-repository", local, "--nexus-root", server.URL, "--repository-name", "", "--verify-content-type-map"}
+
+	if err := runCrawler(t, args...); err != nil {
+		t.Fatal(err)
+	}
+	// No expectation for .module files nor the directories.
+	want := []string{server.URL + "/org/e/lib/1.0/lib-1.0.jar"}
+	if got := findingPaths(categoryContentType); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("content-type-mismatch findings = %v, want %v", got, want)
+	}
+
+	if err := runCrawler(t, append(args, "--content-type-map", ".module=application/vnd.org.gradle.module+json, .jar=text/plain")...); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{server.URL + "/org/e/lib/1.0/lib-1.0-sources.jar", server.URL + "/org/e/lib/1.0/lib-1.0.module"}
+	if got := findingPaths(categoryContentType); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("with --content-type-map, content-type-mismatch findings = %v, want %v", got, want)
+	}
+	if err := parseContentTypeMap("jar=text/plain"); err == nil {
+		t.Error("an entry without the dot of its extension was accepted")
+	}
+}
@@ -1,19 +1,22 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
 	"log"
-	"time"
 	"net/http"
+	"net/url"
 	"path/filepath"
+	"runtime"
 	"sync"
+	"sync/atomic"
 	"errors"
-	"crypto/md5"
-	"crypto/sha1"
+	"io"
 	"io/ioutil"
-	"encoding/hex"
+	"strings"
+	"time"
 )
 
 //Options:
@@ -30,152 +33,1175 @@ import (
 //--md5Sum                 Verify md5Sum checksums
 //--sha1Sum                Verify sha1Sum checksums
 
-var mavenRepo = flag.String("maven-repository", "", "path to directory containing the exploded maven-repository. Required")
-var mavenRepoName = flag.String("repository-name", "ga", "Repository name or release group to test. Optional")
-var nexusRoot = flag.String("nexus-root", "https://maven.repository.redhat.com", "Nexus base URL. Optional")
+var archivePath = flag.String("archive", "", "Check a packed Maven repository, a .zip, .tar, .tar.gz or .tgz file, instead of an exploded --maven-repository, without extracting it. Not supported with --local-only. Optional")
+var mavenRepoName = flag.String("repository-name", "ga", "Repository name or release group to test, or a comma separated list of them. Empty checks artifacts directly below --nexus-root. Optional")
+// defaultNexusRoot is checked when no --nexus-root is given.
+const defaultNexusRoot = "https://maven.repository.redhat.com"
+
+// nexusRoots holds the repeatable --nexus-root flag. The first root is the
+// primary remote, the others are mirrors tried in order for artifacts it lacks.
+var nexusRoots stringList
+var prefix = flag.String("prefix", "", "Only scan this subtree of --maven-repository, e.g. org/apache/maven. Optional")
+var remoteBasePath = flag.String("remote-base-path", "", "Path inserted between the Nexus base URL and the repository name, e.g. content/repositories. Optional")
 var jarsOnly = flag.Bool("jars-only", false, "Check for .jar localFiles only. Optional")
-var json = flag.Bool("json", false, "Dump missing artifacts to a .json file. Optional")
+var dumpJSON = flag.Bool("json", false, "Dump missing artifacts to a .json file. Optional")
+var jsonFile = flag.String("json-file", "missing_artifacts.json", "File the missing artifacts are dumped to with --json. Optional")
+var dedupeIdenticalFiles = flag.String("dedupe-identical-files", "", "Write the sets of local files with identical content at different paths to this JSON file. Optional")
+var artifactAgeReport = flag.String("artifact-age-report", "", "Write the oldest and newest local mtime of every artifact groupId:artifactId, its latest version and an age bucket to this JSON file, stalest first, to spot dependencies that aren't updated anymore. Optional")
+var msgpackFile = flag.String("msgpack-file", "", "Also dump the missing artifacts report as MessagePack to this file, with the field names of the --json dump. Optional")
+var reconcileFile = flag.String("reconcile-report", "", "Write the actions making the local mirror match the remote to this JSON file: delete the local files the remote answers 404 or 410 for, recheck those it timed out or kept failing on, download again those whose checksum differs (with --md5Sum/--sha1Sum). Optional")
+var artifactInventory = flag.String("artifact-inventory", "", "Write the coordinates, checksums and remote URL of every artifact the remote serves to this JSON file, for SBOM tooling. Optional")
+var compressOutput = flag.Bool("compress-output", false, "Gzip every report file. Report paths ending with .gz are compressed regardless. Optional")
+var boundedMemory = flag.Bool("bounded-memory", false, "Keep memory flat on huge trees by not holding every present artifact: duplicates across repository groups aren't reported, and --healthy-out, --artifact-inventory and --dedupe-identical-files are unavailable. Lost artifacts and findings are still listed. Optional")
+var healthyOut = flag.String("healthy-out", "", "Write artifacts confirmed present remotely to this file, as JSON if it ends with .json or .json.gz, plain text otherwise. Optional")
 var test = flag.Bool("test", false, "Don't actually HTTP GET artifacts. Optional")
 var md5Sum = flag.Bool("md5Sum", false, "Verify md5Sum checksums. Optional")
 var sha1Sum = flag.Bool("sha1Sum", false, "Verify sha1Sum checksums. Optional")
+var checksumList = flag.String("checksum", "", "Comma separated checksums to compute and verify against the remote sidecars: md5, sha1, sha256, sha512. md5 and sha1 are the same as --md5Sum and --sha1Sum. Optional")
+var etagAsMD5 = flag.Bool("etag-as-md5", false, "Compare an ETag that looks like an MD5 with the local md5 instead of fetching the .md5 sidecar. Optional")
+var normalizeChecksumCase = flag.Bool("normalize-checksum-case", false, "Also strip the filename suffix from \"<hash>  <filename>\" checksum files. Comparison is always case-insensitive. Optional")
+var dialTimeout = flag.Duration("dial-timeout", 30*time.Second, "Timeout for establishing a connection to the remote. Optional")
+var tlsHandshakeTimeout = flag.Duration("tls-handshake-timeout", 10*time.Second, "Timeout for the TLS handshake with the remote. Optional")
+var canonicalizeRedirects = flag.Bool("canonicalize-redirects", false, "Don't follow redirects; report the redirect target of every artifact and whether it leaves the remote host. Optional")
+var reportRedirectChains = flag.Bool("report-redirect-chains", false, "Record every hop of the redirects followed per artifact and report the chains, flagging those leaving the remote host. Optional")
+var http2 = flag.Bool("http2", false, "Negotiate HTTP/2 with servers that support it, falling back to HTTP/1.1. Optional")
+var noCache = flag.Bool("no-cache", false, "Send Cache-Control: no-cache and Pragma: no-cache so intermediary caches revalidate every request with the origin. Optional")
+var onlyCategoriesFlag = flag.String("only-categories", "", "Comma separated outcomes and finding categories to output per artifact and in the report files, e.g. lost,checksum-mismatch. The summary still counts everything. Optional")
+var baseline = flag.String("baseline", "", "A --json report of a previous run; only the artifacts newly lost, newly mismatched or recovered since are output per artifact, compared by path on their outcome and finding categories, the summary counts the changes. Optional")
+var allowedHosts = flag.String("allowed-hosts", "", "Comma separated hosts, optionally with port, the crawler may send requests to, including followed redirects. Empty allows any. Optional")
+var proxy = flag.String("proxy", "", "Proxy URL to send requests through, defaults to the HTTP_PROXY/HTTPS_PROXY environment. Optional")
+var proxyUser = flag.String("proxy-user", "", "User to authenticate against the proxy with. Optional")
+var proxyPassword = flag.String("proxy-password", "", "Password of --proxy-user. Optional")
+var clientCert = flag.String("client-cert", "", "PEM client certificate for mutual TLS, requires --client-key. Optional")
+var clientKey = flag.String("client-key", "", "PEM private key of --client-cert. Optional")
+var runID = flag.String("run-id", "", "Identifier embedded in logs and reports to correlate a run, e.g. a CI build number. Generated when empty. Optional")
+var anyChecksumOk = flag.Bool("any-checksum-ok", false, "With --md5Sum and --sha1Sum, accept an artifact once one remote checksum matches instead of requiring all of them. Optional")
+var forbiddenIsOk = flag.Bool("forbidden-is-ok", false, "Treat files answering 403 Forbidden as present instead of reporting them as forbidden. Optional")
+var followMetadata = flag.Bool("follow-metadata", false, "Check remotely every version listed in maven-metadata.xml, including versions absent locally. Optional")
+var includeChecksumFiles = flag.Bool("include-checksum-files-as-artifacts", true, "Check .md5/.sha1 files remotely as artifacts; reports group them under their primary artifact. Optional")
+var groupDeadline = flag.Duration("group-deadline", 0, "Time budget of each repository group; a group still running when it expires is reported as partially checked. 0 for none. Optional")
+var resolveSnapshots = flag.Bool("resolve-snapshots", false, "Check the local -SNAPSHOT files against the timestamped files the remote maven-metadata.xml of their version directory lists. Optional")
+var stallTimeout = flag.Duration("stall-timeout", 0, "Cancel a repository group when no result arrived for this long, reporting it as partially checked. 0 for none. Optional")
+var dirCheck = flag.String("dir-check", "all", "Which local directories to check remotely: all, leaf for directories without subdirectories (the version directories, far fewer requests) or none. Optional")
+var skipEmptyDirs = flag.Bool("skip-empty-dirs", false, "Don't check empty local directories remotely, only report them. Optional")
+var verifyContentType = flag.Bool("verify-content-type", false, "Flag binary artifacts the remote answers with an HTML page, sniffing the first bytes when the Content-Type isn't conclusive. Optional")
+var verifySizeFlag = flag.Bool("verify-size", false, "Flag files whose remote Content-Length differs from their local size, e.g. truncated uploads. Remotes not announcing a length aren't judged. Optional")
+var verifyContentTypeMap = flag.Bool("verify-content-type-map", false, "Flag files whose Content-Type doesn't match the one expected for their extension, e.g. application/java-archive for .jar. Optional")
+var contentTypeMap = flag.String("content-type-map", "", "Comma separated .ext=type[|type...] entries extending or overriding the --verify-content-type-map defaults. Optional")
+var eventsSocket = flag.String("events-socket", "", "Stream NDJSON progress and result events to readers of this Unix socket. Optional")
+var since = flag.String("since", "", "Only check local files modified since this duration ago (e.g. 24h) or timestamp (RFC 3339 or 2006-01-02). Optional")
+var requestTimeout = flag.Duration("request-timeout", 0, "Timeout of every attempt of an artifact request, 0 for none. Optional")
+var retryTimeoutMultiplier = flag.Float64("retry-timeout-multiplier", 1, "Multiply the --request-timeout by this for every retry, e.g. 2 doubles it, so a big artifact under load gets more time than the first snappy attempt. Optional")
+var remoteTimeoutBudget = flag.Float64("remote-timeout-budget", 0, "Fraction of failed requests (transport errors, timeouts, 5xx, 429) over the last --remote-timeout-window above which half of the active workers are parked to ease the load on the remote, e.g. 0.2. They are restored one by one while failures stay below half of it. 0 disables it. Optional")
+var remoteTimeoutWindow = flag.Int("remote-timeout-window", 50, "Number of recent requests --remote-timeout-budget is judged on. Optional")
+var maxRetries = flag.Int("max-retries", 0, "Retry a request failing with a transport error or a 5xx this many times. Optional")
+var on429 = flag.String("on-429", "retry", "How a 429 Too Many Requests is handled: retry it like a 5xx, backoff-global to pause every worker for its Retry-After before retrying, at least once, or fail the run. Optional")
+var timeoutAs = flag.String("timeout-as", "error", "How an artifact whose requests keep timing out is classified: error stops the run as an infrastructure problem, lost reports it lost with status timeout. Optional")
+var retryBudget = flag.Int64("retry-budget", 0, "Cap the retries of the whole run, so a degraded server can't make it retry forever. 0 for no cap. Optional")
+var trustedManifest = flag.String("trusted-manifest", "", "md5sum/sha1sum style manifest of known-good files, \"<hash>  <path>\" relative to the repository root; a local file at a listed path with a listed digest is trusted and not checked remotely. Optional")
+var limit = flag.Int64("limit", 0, "Stop after this many artifacts were checked remotely, for bounded smoke tests. 0 for no limit. Optional")
+var topLost = flag.Int("top-lost", 10, "How many of the largest lost files, by local size, the summary and the --json dump list. 0 for none. Optional")
+var timeFormat = flag.String("time-format", "rfc3339", "Format of the timestamps in logs, events and reports: rfc3339 or unix. Optional")
+var timezone = flag.String("timezone", "", "IANA time zone of the timestamps in logs, events and reports, e.g. UTC. Defaults to the local zone. Optional")
+var lineTemplate = flag.String("line-template", "", "Print a line per checked artifact to stdout with this Go text/template, e.g. '{{.Code}} {{.Path}}'. Fields: Path, RelPath, Group, Code, Status, Outcome, IsDir, Size, MD5, SHA1, Seconds, Mirror, Findings. Optional")
+var groupConcurrency = flag.Int("group-concurrency", 1, "Check this many --repository-name groups at once, splitting the --threads workers between them. Groups are checked one after the other by default. Optional")
+var flushInterval = flag.Duration("flush-interval", time.Second, "How often the buffered --line-template output is flushed, 0 flushes every line. It is always flushed at the end of the run. Optional")
+var batchSummaryInterval = flag.String("batch-summary-interval", "", "Log a partial summary every this many checked artifacts (e.g. 1000) or this often (e.g. 30s). Optional")
+var precountFlag = flag.Bool("precount", false, "Count the local tree in a quick first pass, without hashing or HTTP, so the partial summaries show the walk as a percentage. Walks the tree twice, off for very large trees. Optional")
+var strict = flag.Bool("strict", false, "Treat every finding as a failure, including the warnings: missing sidecars, content type mismatches, redirects, forbidden files, empty directories and non-canonical paths. Optional")
+var quietOnSuccess = flag.Bool("quiet-on-success", false, "Print a single success line for a clean crawl: nothing lost, checked completely and no failure finding. Any other run prints its log and the full summary at the end instead. Report files are written either way. Optional")
+var dumpRequests = flag.Bool("dump-requests", false, "Log the method, URL and headers of every request sent and the status and key headers of its response, to debug URL construction. Authorization headers and URL credentials are redacted. Very verbose. Optional")
 var verbose = flag.Bool("verbose", false, "Print results for each file/folder. Optional")
 var threads = flag.Int("threads", 20, "The number of parallel threads to use to connect to repository. Optional")
+var listRepositories = flag.Bool("list-repositories", false, "List the repositories and groups the Nexus REST API exposes, then exit. Optional")
+var gav = flag.String("gav", "", "Check a single artifact groupId:artifactId:version[:classifier[:packaging]] remotely instead of walking --maven-repository. Optional")
+var gavFile = flag.String("gav-file", "", "Check the artifacts of this file, one groupId:artifactId:version[:classifier[:packaging]] per line, remotely instead of walking --maven-repository, e.g. a release bill of materials. Blank lines and lines starting with # are skipped. Optional")
+var pinDNSFlag = flag.Bool("pin-dns", false, "Resolve the remote hosts once before the crawl and dial the resolved addresses for every request, so a load balancer rotating its DNS mid-crawl doesn't mix backends. Optional")
+var compareRemote = flag.String("compare-remote", "", "Second Nexus base URL to check every artifact against, reporting artifacts present on only one of them. Optional")
+var certExpiry = flag.Duration("check-cert-expiry", 0, "Before the crawl, report the TLS certificate of every --nexus-root and --compare-remote host as cert-expiring when it expires within this long, e.g. 720h. A warning, a failure with --strict. Optional")
+var noPreflight = flag.Bool("no-preflight", false, "Skip the connectivity check against the remote before the crawl. Optional")
+var localChecks = flag.Bool("local-checks", false, "Also run every --local-only check (checksum sidecars, zero-byte files, POM validity, Maven layout) during a remote check. Optional")
+var fullAudit = flag.Bool("full-audit", false, "Turn on every check in one walk: --md5Sum, --sha1Sum, --verify-size, --verify-content-type, --verify-content-type-map, --follow-metadata and --local-checks, unless given explicitly, e.g. --follow-metadata=false. Expect it to be several times slower than the plain existence check: most artifacts cost up to four requests instead of one, the check itself, the .md5 and .sha1 sidecars and a ranged GET sniffing the content, while locally every file is still read and hashed once, only POMs and checksum sidecars being read again for the local checks. Optional")
+var checkLocalChecksums = flag.Bool("check-local-checksums", false, "Also compare every local artifact against its local .md5/.sha1 sidecars during a remote check, reporting local corruption as local-checksum-mismatch. Always done with --local-only. Optional")
+var downloadMarkers = flag.String("download-markers", "*.part,*.lastUpdated,_remote.repositories", "Comma separated file name patterns of interrupted download leftovers, reported as incomplete-download instead of being checked remotely. Empty disables it. Optional")
+var localOnly = flag.Bool("local-only", false, "Run only the local checks (checksum sidecars, zero-byte files, POM validity, Maven layout) without any HTTP. Optional")
 
 var repo Repository
+var repoGroups []string
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// mavenRoots holds the repeatable --maven-repository flag, every root is
+// checked in one run.
+var mavenRoots stringList
+var sinceTime time.Time
+
+// remoteChecks counts the artifacts the workers started to check remotely,
+// against --limit.
+var remoteChecks int64
 
 type Repository struct {
+	runID          string
 	repoName       string
 	basePathLocal  string
 	basePathRemote string
 	lostDirs       []string
 	lostFiles      []string
+	lostSizes      map[string]int64
+	lostByRoot     map[string][]string
+	findings       map[string][]Finding
+	healthy        []Result
+	// present counts the healthy results, which --bounded-memory doesn't keep.
+	present int
+	// reconcile collects the --reconcile-report actions.
+	reconcile []reconcileEntry
+	byStatus       map[string]breakdown
+	byGroup        map[string]breakdown
+	byExtension    map[string]extensionCounts
+	presentIn      map[string][]string
+	// servedBy counts the artifacts each fallback --nexus-root served.
+	servedBy map[string]int
+	// gavOutcomes maps the paths of --gav and --gav-file to their outcome,
+	// present winning over the other groups.
+	gavOutcomes map[string]string
+	groupStatus    map[string]string
+	preflight      string
+	startedAt      time.Time
+	finishedAt     time.Time
+	limitReached   bool
+	trusted        int
+	// notChecked counts artifacts whose check was cancelled in flight.
+	notChecked int
+	redirectChains map[string][]string
+}
+
+// breakdown accumulates the requests issued and the time spent on them.
+type breakdown struct {
+	Requests int     `json:"requests"`
+	Seconds  float64 `json:"seconds"`
+}
+
+// extensionCounts tallies the files of one extension checked and lost.
+type extensionCounts struct {
+	Checked int `json:"checked"`
+	Lost    int `json:"lost"`
 }
 
+// Finding is a single problem detected for an artifact, filed under a category
+// such as categoryZeroByte.
+type Finding struct {
+	path   string
+	detail string
+}
+
+const (
+	categoryChecksumMismatch = "checksum-mismatch"
+	categoryZeroByte         = "zero-byte"
+	categoryInvalidPom       = "invalid-pom"
+	categoryMirrorMismatch   = "mirror-mismatch"
+	categoryLocalReadError   = "local-read-error"
+	categoryMissingSidecar   = "missing-sidecar"
+	categoryTypeMismatch     = "type-mismatch"
+	categoryMetadataVersion  = "metadata-version-missing"
+	categoryForbidden        = "forbidden"
+	categoryRedirect         = "redirect"
+	categoryEmptyDir         = "empty-dir"
+	categoryHTMLPage         = "html-page"
+	categoryNonCanonicalPath = "non-canonical-path"
+	categoryContentType      = "content-type-mismatch"
+	categoryOrphanChecksum   = "orphan-checksum"
+	// categoryLocalChecksum is a local sidecar disagreeing with its artifact,
+	// as opposed to categoryChecksumMismatch against the remote sidecar.
+	categoryLocalChecksum = "local-checksum-mismatch"
+	// categoryDownloadMarker is a leftover of an interrupted Maven download.
+	categoryDownloadMarker = "incomplete-download"
+	// categoryCertExpiry is the remote's TLS certificate close to its expiry.
+	categoryCertExpiry = "cert-expiring"
+	// categorySizeMismatch is a remote file longer or shorter than the local one.
+	categorySizeMismatch = "size-mismatch"
+)
+
+// maxThreadsPerCPU caps --threads. The workers mostly wait on the network, but
+// beyond this the remote sees a flood of connections for no gain.
+const maxThreadsPerCPU = 64
+
+var dirsAcceptable = []int{200, 301, 302}
+
+const fileAcceptable = 200
+
 type Result struct {
-	path string
-	code int
-	status  string
-	err  error
-	isDir bool
+	path          string
+	relPath       string
+	group         string
+	code          int
+	status        string
+	err           error
+	isDir         bool
+	compareCode   int
+	compareStatus string
+	compareErr    error
+	localErr      error
+	elapsed       time.Duration
+	findings      []remoteFinding
+	fromMetadata  bool
+	emptyDir      bool
+	location      string
+	checksums
+	size          int64
+	// redirects are the hops followed with --report-redirect-chains.
+	redirects []string
+	// skipped marks an artifact that was walked but not checked remotely.
+	skipped bool
+	// trusted marks a file skipped because --trusted-manifest lists its digest.
+	trusted bool
+	root    string
+	// mirror is the fallback --nexus-root that served an artifact the primary
+	// one lacks, empty when the primary served it.
+	mirror string
+}
+
+// where names a local artifact in findings: its relative path, prefixed with
+// its root when several roots are checked.
+func (a LocalArtifact) where() string {
+	return localPath(a.root, a.path)
+}
+
+func localPath(root string, relPath string) string {
+	if len(mavenRoots) > 1 {
+		return filepath.Join(root, relPath)
+	}
+	return relPath
+}
+
+// remoteFinding is a problem detected by a worker while checking an artifact.
+type remoteFinding struct {
+	category string
+	detail   string
 }
 
 type LocalArtifact struct {
-	path string
-	md5 string
-	sha1 string
+	// root is the --maven-repository the artifact was walked in.
+	root  string
+	path  string
+	// checksums are the digests computed from the file content.
+	checksums
+	size  int64
 	isDir bool
+	err   error
+	// modTime is the local modification time of a file.
+	modTime time.Time
+	// emptyDir marks a directory with neither files nor subdirectories.
+	emptyDir bool
+	// leafDir marks a directory without subdirectories, typically a version.
+	leafDir bool
+	// fromMetadata marks a version directory listed in maven-metadata.xml
+	// but absent from the local tree.
+	fromMetadata bool
 }
 
 func init() {
+	flag.Var(&pathRewrites, "path-rewrite", "Regex rule s/pattern/replacement/ mapping local paths to the remote layout before the URL is built; repeatable, applied in order. Optional")
+	flag.Var(&classifiers, "classifier", "Only check artifacts with this classifier, e.g. sources, or the main artifact when empty; repeatable. Optional")
+	flag.Var(&mavenRoots, "maven-repository", "path to directory containing the exploded maven-repository; repeat it to check several in one run. Required")
+	flag.Var(&nexusRoots, "nexus-root", "Nexus base URL, or a file:///path of a local directory to check against offline; defaults to "+defaultNexusRoot+". Repeat it to fall back to further mirrors in order, for the artifacts the ones before lack or fail to answer for; an artifact any of them serves is present. Optional")
+}
+
+// parseFlags parses and validates the command line, exiting with 3 on invalid
+// arguments, and prepares the run they describe.
+func parseFlags() {
 	flag.Parse()
-	if *mavenRepo != "" {
+	if err := applyEnvironment(); err != nil {
+		fmt.Println(err)
+		os.Exit(3)
+	}
+	if *fullAudit {
+		applyFullAudit()
+	}
+	// Defaulted only now, NEXUS_CRAWLER_NEXUS_ROOT would be a mirror otherwise.
+	if len(nexusRoots) == 0 {
+		nexusRoots = stringList{defaultNexusRoot}
+	}
+	for i, root := range nexusRoots {
+		normalized, err := validateNexusRoot(root)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(3)
+		}
+		nexusRoots[i] = normalized
+	}
+	if err := parseTimeFlags(); err != nil {
+		fmt.Println(err)
+		os.Exit(3)
+	}
+	log.SetFlags(0)
+	log.SetOutput(timestampWriter{os.Stderr})
+	if len(mavenRoots) > 0 || checkingGAVs() || *archivePath != "" || *listRepositories {
 		repo = Repository{
-			basePathLocal:  *mavenRepo,
-			basePathRemote: *nexusRoot,
+			basePathLocal:  mavenRoots.String(),
+			basePathRemote: nexusRoots[0],
 			lostDirs:       []string{},
 			lostFiles:      []string{},
+			lostSizes:      map[string]int64{},
+			lostByRoot:     map[string][]string{},
+			findings:       map[string][]Finding{},
+			byStatus:       map[string]breakdown{},
+			byGroup:        map[string]breakdown{},
+			byExtension:    map[string]extensionCounts{},
+			presentIn:      map[string][]string{},
+			servedBy:       map[string]int{},
+			gavOutcomes:    map[string]string{},
+			groupStatus:    map[string]string{},
+			redirectChains: map[string][]string{},
+		}
+		repoGroups = parseRepoGroups(*mavenRepoName)
+		if *archivePath != "" {
+			if len(mavenRoots) > 0 || checkingGAVs() || *localOnly || *checkLocalChecksums || *localChecks {
+				fmt.Println("--archive cannot be combined with --maven-repository, --gav, --gav-file, --local-only, --check-local-checksums or --local-checks")
+				os.Exit(3)
+			}
+			if err := validateArchive(*archivePath); err != nil {
+				fmt.Println(err)
+				os.Exit(3)
+			}
+		}
+		if *precountFlag && (*archivePath != "" || checkingGAVs() || *localOnly) {
+			fmt.Println("--precount only counts --maven-repository walks, it cannot be combined with --archive, --gav, --gav-file or --local-only")
+			os.Exit(3)
+		}
+		if !checkingGAVs() && *archivePath == "" && !*listRepositories {
+			for _, root := range mavenRoots {
+				if err := validateMavenRepo(root); err != nil {
+					fmt.Println(err)
+					os.Exit(3)
+				}
+				if err := validatePrefix(root, *prefix); err != nil {
+					fmt.Println(err)
+					os.Exit(3)
+				}
+			}
+		}
+		if *gav != "" && *gavFile != "" {
+			fmt.Println("--gav cannot be combined with --gav-file")
+			os.Exit(3)
+		}
+		if *gav != "" {
+			target, err := parseGAV(*gav)
+			if err != nil {
+				fmt.Printf("Invalid --gav: %v\n", err)
+				os.Exit(3)
+			}
+			gavTargets = []GAV{target}
+		}
+		if *gavFile != "" {
+			var err error
+			if gavTargets, err = loadGAVFile(*gavFile); err != nil {
+				fmt.Println(err)
+				os.Exit(3)
+			}
+		}
+		if *dirCheck != "all" && *dirCheck != "leaf" && *dirCheck != "none" {
+			fmt.Printf("--dir-check must be all, leaf or none, got %v\n", *dirCheck)
+			os.Exit(3)
+		}
+		for _, pattern := range strings.Split(*downloadMarkers, ",") {
+			if _, err := filepath.Match(strings.TrimSpace(pattern), ""); err != nil {
+				fmt.Printf("--download-markers: invalid pattern %q\n", pattern)
+				os.Exit(3)
+			}
+		}
+		if err := parseChecksums(*checksumList); err != nil {
+			fmt.Println(err)
+			os.Exit(3)
+		}
+		if *timeoutAs != "lost" && *timeoutAs != "error" {
+			fmt.Printf("--timeout-as must be lost or error, got %v\n", *timeoutAs)
+			os.Exit(3)
+		}
+		if *retryTimeoutMultiplier < 1 {
+			fmt.Printf("--retry-timeout-multiplier must be at least 1, got %v\n", *retryTimeoutMultiplier)
+			os.Exit(3)
+		}
+		if *remoteTimeoutBudget < 0 || *remoteTimeoutBudget >= 1 {
+			fmt.Printf("--remote-timeout-budget must be a fraction from 0 to below 1, got %v\n", *remoteTimeoutBudget)
+			os.Exit(3)
+		}
+		if *remoteTimeoutWindow < 1 {
+			fmt.Printf("--remote-timeout-window must be at least 1, got %v\n", *remoteTimeoutWindow)
+			os.Exit(3)
+		}
+		if *on429 != "retry" && *on429 != "backoff-global" && *on429 != "fail" {
+			fmt.Printf("--on-429 must be retry, backoff-global or fail, got %v\n", *on429)
+			os.Exit(3)
+		}
+		if *threads < 1 {
+			fmt.Printf("--threads must be at least 1, got %v\n", *threads)
+			os.Exit(3)
+		}
+		if *boundedMemory && (*healthyOut != "" || *artifactInventory != "" || *dedupeIdenticalFiles != "" || *artifactAgeReport != "") {
+			fmt.Println("--bounded-memory cannot be combined with --healthy-out, --artifact-inventory, --dedupe-identical-files or --artifact-age-report")
+			os.Exit(3)
+		}
+		if *boundedMemory && *reconcileFile != "" && len(repoGroups) > 1 {
+			// Without presentIn, files present in another group would be listed for deletion.
+			fmt.Println("--bounded-memory cannot be combined with --reconcile-report over several repository groups")
+			os.Exit(3)
+		}
+		if *groupConcurrency < 1 {
+			fmt.Printf("--group-concurrency must be at least 1, got %v\n", *groupConcurrency)
+			os.Exit(3)
+		}
+		if maxThreads := maxThreadsPerCPU * runtime.GOMAXPROCS(0); *threads > maxThreads {
+			log.Printf("--threads %v is more than %v per CPU, capping it to %v", *threads, maxThreadsPerCPU, maxThreads)
+			*threads = maxThreads
+		}
+		if *remoteTimeoutBudget > 0 {
+			workerSlots = newWorkerLimit(*threads, *remoteTimeoutWindow)
+		}
+		if *since != "" {
+			var err error
+			if sinceTime, err = parseSince(*since, time.Now()); err != nil {
+				fmt.Println(err)
+				os.Exit(3)
+			}
+		}
+		if *batchSummaryInterval != "" {
+			var err error
+			if batches, err = newBatchReporter(*batchSummaryInterval); err != nil {
+				fmt.Println(err)
+				os.Exit(3)
+			}
+		}
+		if *lineTemplate != "" {
+			var err error
+			if lines, err = newTemplateReporter(*lineTemplate); err != nil {
+				fmt.Println(err)
+				os.Exit(3)
+			}
+		}
+		if *baseline != "" {
+			if err := loadBaseline(*baseline); err != nil {
+				fmt.Println(err)
+				os.Exit(3)
+			}
+		}
+		if *trustedManifest != "" {
+			if err := loadTrustedManifest(*trustedManifest); err != nil {
+				fmt.Println(err)
+				os.Exit(3)
+			}
+		}
+		if err := parseContentTypeMap(*contentTypeMap); err != nil {
+			fmt.Println(err)
+			os.Exit(3)
+		}
+		if err := parseOnlyCategories(*onlyCategoriesFlag); err != nil {
+			fmt.Println(err)
+			os.Exit(3)
+		}
+		if err := parseAllowedHosts(); err != nil {
+			fmt.Println(err)
+			os.Exit(3)
+		}
+		if err := validateProxy(); err != nil {
+			fmt.Println(err)
+			os.Exit(3)
+		}
+		if err := loadClientCertificate(); err != nil {
+			fmt.Println(err)
+			os.Exit(3)
 		}
 
 	} else {
 		fmt.Println("Required arg is missed...")
 		fmt.Println("Usage:")
 		flag.PrintDefaults()
+		fmt.Println("Every flag can also be set with a " + envPrefix + "<NAME> environment variable, e.g. " +
+			envKey("nexus-root") + ". Flags given on the command line take precedence.")
 		os.Exit(3)
 	}
 }
 
+// parseRepoGroups splits the --repository-name list. An empty name stands for
+// the remote root itself, so artifacts are looked up right below --nexus-root;
+// empty entries of a longer list are stray commas and dropped.
+func parseRepoGroups(names string) []string {
+	groups := []string{}
+	for _, group := range strings.Split(names, ",") {
+		if group = strings.Trim(strings.TrimSpace(group), "/"); group != "" {
+			groups = append(groups, group)
+		}
+	}
+	if len(groups) == 0 {
+		groups = append(groups, "")
+	}
+	return groups
+}
+
+// validateMavenRepo makes sure --maven-repository is a directory with something to scan.
+func validateMavenRepo(path string) error {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("--maven-repository %v does not exist", path)
+	}
+	if err != nil {
+		return fmt.Errorf("--maven-repository %v cannot be read: %v", path, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("--maven-repository %v is not a directory", path)
+	}
+	dir, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("--maven-repository %v cannot be read: %v", path, err)
+	}
+	defer dir.Close()
+	if _, err := dir.Readdirnames(1); err == io.EOF {
+		return fmt.Errorf("--maven-repository %v is empty, nothing to scan", path)
+	}
+	return nil
+}
+
+// parseSince turns --since into the oldest modification time still checked,
+// from a duration before now or an absolute timestamp.
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("--since %v is neither a duration nor a RFC 3339 or 2006-01-02 timestamp", value)
+}
+
+// validateNexusRoot requires an absolute http or https URL, or a file:// one,
+// and strips its trailing slashes so URLs are built predictably.
+func validateNexusRoot(root string) (string, error) {
+	u, err := url.Parse(root)
+	if err != nil {
+		return "", fmt.Errorf("--nexus-root %v is not a URL: %v", root, err)
+	}
+	switch {
+	case u.Scheme == "file" && u.Path != "":
+	case (u.Scheme == "http" || u.Scheme == "https") && u.Host != "":
+	case u.Scheme == "":
+		return "", fmt.Errorf("--nexus-root %v has no scheme, did you mean https://%v?", root, strings.TrimPrefix(root, "//"))
+	default:
+		return "", fmt.Errorf("--nexus-root %v must be an absolute http:// or https:// URL", root)
+	}
+	return strings.TrimRight(root, "/"), nil
+}
+
+// validatePrefix makes sure --prefix names a directory inside the local root.
+func validatePrefix(root string, prefix string) error {
+	if prefix == "" {
+		return nil
+	}
+	clean := filepath.Clean(prefix)
+	if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("--prefix %v must be relative to --maven-repository", prefix)
+	}
+	info, err := os.Stat(filepath.Join(root, clean))
+	if err != nil {
+		return fmt.Errorf("--prefix %v cannot be read: %v", prefix, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("--prefix %v is not a directory", prefix)
+	}
+	return nil
+}
+
 func main() {
+	parseFlags()
+	if *listRepositories {
+		if err := printRepositories(newHTTPClient(), os.Stdout); err != nil {
+			log.Printf("List repositories error: %v", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if *eventsSocket != "" {
+		var err error
+		if events, err = openEventStream(*eventsSocket); err != nil {
+			log.Printf("Events socket error: %v", err)
+			os.Exit(1)
+		}
+	}
+	if *quietOnSuccess {
+		holdLog()
+	}
 	err := scan()
 	if err != nil {
 		log.Printf("Scan error: %v", err.Error())
 	}
-	log.Printf("Repo: %v", repo)
+	if lines != nil {
+		lines.flush()
+	}
+	if reportErr := writeReports(); reportErr != nil {
+		log.Printf("Report error: %v", reportErr)
+		err = reportErr
+	}
+	if quietLog == nil || !releaseLog(err) {
+		logSummary()
+	}
+	events.finish(err)
+	events.close()
+	if err != nil {
+		os.Exit(1)
+	}
+	if hasFailures() {
+		os.Exit(exitFindings)
+	}
 }
 
-func scanLocalPath(done <-chan struct{}, rootPath string) (<-chan LocalArtifact, <-chan error) {
+// scanLocalPath walks rootPath below the local root, emitting artifacts with
+// paths relative to root.
+func scanLocalPath(done <-chan struct{}, root string, rootPath string) (<-chan LocalArtifact, <-chan error) {
 	artifacts := make(chan LocalArtifact)
 	errs := make(chan error, 1)
 	go func () {
 		defer close(artifacts)
-		absoluteLocalPath := *mavenRepo + rootPath
-		errs <- filepath.Walk(absoluteLocalPath, func(path string, f os.FileInfo, err error) error {
-			relativePath, relPathErr := filepath.Rel(*mavenRepo, path)
+		var dirs dirTracker
+		want := neededDigests()
+		emit := func(emitted []LocalArtifact) error {
+			for _, a := range emitted {
+				a.root = root
+				select {
+					case artifacts <- a:
+					case <- done:
+						return errors.New("Scan cancelled ...")
+				}
+			}
+			return nil
+		}
+		absoluteLocalPath := filepath.Join(root, rootPath)
+		walkErr := filepath.Walk(absoluteLocalPath, func(path string, f os.FileInfo, err error) error {
+			relativePath, relPathErr := filepath.Rel(root, path)
 			if relPathErr != nil {
 				return relPathErr
 			}
 
-			var fileMd5 [16]byte
-			var fileSha1 [20]byte
-
-			if !f.IsDir() {
-				file, err := ioutil.ReadFile(path)
-				if err != nil {
-					return err
+			// Unreadable files and directories, the root included, are
+			// reported as findings instead of aborting the walk.
+			artifact := LocalArtifact{root: root, path: relativePath, isDir: f != nil && f.IsDir(), err: err}
+			emitted := dirs.visit(path, artifact.isDir)
+			if artifact.isDir && err == nil {
+				dirs.push(artifact, path)
+				return emit(emitted)
+			}
+			if err == nil && f.ModTime().Before(sinceTime) {
+				return emit(emitted)
+			}
+			if err == nil {
+				artifact.modTime = f.ModTime()
+				artifact.checksums, artifact.err = hashFile(path, wantedFor(path, want))
+				artifact.size = f.Size()
+				if *dedupeIdenticalFiles != "" && artifact.err == nil {
+					identicalFiles.add(artifact)
+				}
+				if *artifactAgeReport != "" && artifact.err == nil {
+					artifactAges.add(artifact)
 				}
-				fileMd5 = md5.Sum(file)
-				fileSha1 = sha1.Sum(file)
 			}
-			select {
-				case artifacts <- LocalArtifact {
-					relativePath,
-					hex.EncodeToString(fileMd5[:]),
-					hex.EncodeToString(fileSha1[:]),
-					f.IsDir(),
-				}:
-				case <- done:
-					return errors.New("Scan cancelled ...")
+			emitted = append(emitted, artifact)
+			if artifact.err == nil && *followMetadata && f.Name() == metadataFileName {
+				if content, err := ioutil.ReadFile(path); err == nil {
+					emitted = append(emitted, metadataVersionArtifacts(relativePath, content, dirExists(root))...)
+				}
 			}
-			return nil
+			return emit(emitted)
 		})
+		if walkErr == nil {
+			walkErr = emit(dirs.close())
+		}
+		errs <- walkErr
 	}()
 	return artifacts, errs
 }
 
-func scanRemotePath(done <-chan struct{}, artifacts <-chan LocalArtifact, res chan<- Result) {
-	tr := &http.Transport{
-		MaxIdleConns:       10,
-		IdleConnTimeout:    30 * time.Second,
-		DisableCompression: true,
-	}
-	client := &http.Client{
-		Transport: tr,
-	}
-	var resp *http.Response
-	var err error
+func scanRemotePath(ctx context.Context, client *http.Client, group string, artifacts <-chan LocalArtifact, res chan<- Result) {
+	done := ctx.Done()
 	for artifact := range artifacts {
+		if (!*includeChecksumFiles && isChecksumFile(artifact.path)) || !classifierSelected(artifact) {
+			if !artifact.fromMetadata {
+				atomic.AddInt64(&walked, 1)
+			}
+			continue
+		}
 		relPath := artifact.path
-		url := repo.basePathRemote + "/" + *mavenRepoName +  "/" + relPath
-
-		if  !*test { //TODO: delete negation
-			resp, err = client.Head(url)
-		} else {
-			resp, err = client.Get(url)
-		}
-		select {
-		case res <- Result {
-			url,
-			resp.StatusCode,
-			resp.Status,
-			err,
-			artifact.isDir,
-			}:
-		case <- done:
+		remotePath := pathRewrites.apply(relPath)
+		url := remoteURL(repo.basePathRemote, group, remotePath)
+		if *resolveSnapshots && !artifact.isDir {
+			url = snapshots.resolve(ctx, client, repo.basePathRemote, group, remotePath, url)
+		}
+
+		result := Result{path: url, relPath: relPath, group: group, isDir: artifact.isDir, fromMetadata: artifact.fromMetadata, emptyDir: artifact.emptyDir,
+			checksums: artifact.checksums, size: artifact.size, root: artifact.root}
+		result.trusted = isTrusted(artifact)
+		result.skipped = (artifact.emptyDir && *skipEmptyDirs) || !dirChecked(artifact) || result.trusted || isDownloadMarker(artifact)
+		if artifact.err != nil || result.skipped {
+			result.path = relPath
+			result.localErr = artifact.err
+			select {
+			case res <- result:
+				continue
+			case <- done:
+				return
+			}
+		}
+		if *limit > 0 && atomic.AddInt64(&remoteChecks, 1) > *limit {
 			return
 		}
+		start := time.Now()
+		probeCtx := ctx
+		if *reportRedirectChains {
+			probeCtx = withRedirectChain(ctx)
+		}
+		resp, err := probe(probeCtx, client, url)
+		// A mirror is tried when the ones before it lack the artifact or failed
+		// to answer, the error stands only when every one of them failed.
+		for _, mirror := range nexusRoots[1:] {
+			if err == nil && isPresent(resp.StatusCode, artifact.isDir) {
+				break
+			}
+			mirrorURL := remoteURL(mirror, group, remotePath)
+			if *resolveSnapshots && !artifact.isDir {
+				mirrorURL = snapshots.resolve(ctx, client, mirror, group, remotePath, mirrorURL)
+			}
+			if *reportRedirectChains {
+				probeCtx = withRedirectChain(ctx)
+			}
+			mirrorResp, mirrorErr := probe(probeCtx, client, mirrorURL)
+			switch {
+			case mirrorErr == nil && (err != nil || isPresent(mirrorResp.StatusCode, artifact.isDir)):
+				// Checked further against the mirror serving it, or the first
+				// one answering at all.
+				url, resp, err, result.path, result.mirror = mirrorURL, mirrorResp, nil, mirrorURL, mirror
+			case err != nil:
+				err = mirrorErr
+			}
+		}
+		result.err = err
+		if err == nil {
+			result.code, result.status = resp.StatusCode, resp.Status
+			if result.redirects = redirectChain(resp.Request.Context()); len(result.redirects) > 0 {
+				result.findings = append(result.findings, chainFinding(url, result.redirects)...)
+			}
+			result.findings = append(result.findings, checkRemoteType(artifact, resp)...)
+			result.findings = append(result.findings, verifyContent(ctx, client, url, artifact, resp)...)
+			result.findings = append(result.findings, verifyContentTypeMapping(artifact, resp)...)
+			result.findings = append(result.findings, verifySize(artifact, resp)...)
+			if location, err := resp.Location(); err == nil && resp.StatusCode >= 300 && resp.StatusCode < 400 {
+				result.location = location.String()
+				result.findings = append(result.findings, redirectFinding(resp.Request.URL, location))
+			}
+		}
+		if *compareRemote != "" {
+			compareResp, err := probe(ctx, client, remoteURL(*compareRemote, group, remotePath))
+			result.compareErr = err
+			if err == nil {
+				result.compareCode, result.compareStatus = compareResp.StatusCode, compareResp.Status
+			}
+		}
+		if result.err == nil && result.code == fileAcceptable && !artifact.isDir {
+			etag := ""
+			if *etagAsMD5 {
+				etag = etagMD5(resp)
+			}
+			if *md5Sum || *sha1Sum || len(checksumAlgorithms) > 0 || etag != "" {
+				result.findings = append(result.findings, verifyRemoteChecksums(ctx, client, url, artifact, etag)...)
+			}
+		}
+		result.elapsed = time.Since(start)
+		// Sent even once cancelled, the collector drains res until it's closed
+		// and counts a check cut short as not checked.
+		res <- result
+	}
+}
+
+// dirChecked applies --dir-check to a walked artifact. Version directories
+// listed only in maven-metadata.xml are always checked, that is all there is
+// to check about them.
+func dirChecked(artifact LocalArtifact) bool {
+	if !artifact.isDir || artifact.fromMetadata {
+		return true
+	}
+	switch *dirCheck {
+	case "none":
+		return false
+	case "leaf":
+		return artifact.leafDir
+	}
+	return true
+}
+
+// probe requests url and returns the response with its body already closed.
+// Transport errors, 5xx and 429 answers are retried up to --max-retries times
+// with an exponential backoff, as long as --retry-budget lasts. --on-429 picks
+// how a 429 is handled.
+// Against a remote without HEAD support it asks for the first byte only; a
+// partial answer, or an unsatisfiable range for an empty file, means the file
+// exists and is reported as 200 OK.
+func probe(ctx context.Context, client *http.Client, url string) (*http.Response, error) {
+	method := http.MethodHead
+	if *test || headUnsupported {
+		method = http.MethodGet
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if headUnsupported {
+		req.Header.Set("Range", "bytes=0-0")
+	}
+	if !waitPause(ctx) {
+		return nil, ctx.Err()
+	}
+	resp, err := doAttempt(ctx, client, req, 0)
+	globalBackoff := func(attempt int) bool {
+		if err != nil || resp.StatusCode != http.StatusTooManyRequests || *on429 != "backoff-global" {
+			return false
+		}
+		pauseAll(retryAfter(resp, attempt))
+		return true
+	}
+	paused := globalBackoff(0)
+	// A globally paused 429 is retried once even without --max-retries, or
+	// the pause would be for nothing.
+	retries := *maxRetries
+	if paused && retries == 0 {
+		retries = 1
+	}
+	for attempt := 0; attempt < retries && ctx.Err() == nil && retryable(resp, err); attempt++ {
+		if err == nil {
+			resp.Body.Close()
+		}
+		if !takeRetry() {
+			break
+		}
+		if paused {
+			if !waitPause(ctx) {
+				break
+			}
+		} else if !backoff(ctx, attempt) {
+			break
+		}
+		resp, err = doAttempt(ctx, client, req, attempt+1)
+		paused = globalBackoff(attempt + 1)
+	}
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusTooManyRequests && *on429 == "fail" {
+		return nil, fmt.Errorf("%v answered %v, stopping as asked by --on-429 fail", url, resp.Status)
+	}
+	if headUnsupported && (resp.StatusCode == http.StatusPartialContent || resp.StatusCode == http.StatusRequestedRangeNotSatisfiable) {
+		resp.StatusCode, resp.Status = http.StatusOK, "200 OK"
+	}
+	return resp, nil
+}
+
+// redirectFinding reports the canonical target of a redirect that wasn't
+// followed, warning when it points to another host.
+func redirectFinding(from *url.URL, to *url.URL) remoteFinding {
+	if to.Host != from.Host {
+		return remoteFinding{categoryRedirect, "redirects to " + to.String() + " on unexpected host " + to.Host}
+	}
+	return remoteFinding{categoryRedirect, "redirects to " + to.String()}
+}
+
+// chainFinding warns about a followed redirect chain with a hop on another
+// host than the artifact URL.
+func chainFinding(artifactURL string, chain []string) []remoteFinding {
+	origin, err := url.Parse(artifactURL)
+	if err != nil {
+		return nil
+	}
+	for _, hop := range chain {
+		if to, err := url.Parse(hop); err == nil && to.Host != origin.Host {
+			return []remoteFinding{{categoryRedirect, fmt.Sprintf("redirect chain of %d hops leaves for unexpected host %v", len(chain), to.Host)}}
+		}
+	}
+	return nil
+}
+
+// checkRemoteType flags a file answered with an HTML directory listing and a
+// directory answered with something that isn't a listing.
+func checkRemoteType(artifact LocalArtifact, resp *http.Response) []remoteFinding {
+	if resp.StatusCode != http.StatusOK {
+		return nil
+	}
+	contentType := resp.Header.Get("Content-Type")
+	isHTML := strings.HasPrefix(contentType, "text/html")
+	ext := strings.ToLower(filepath.Ext(artifact.path))
+	// verifyContent reports HTML served for binaries more precisely.
+	coveredByContentCheck := *verifyContentType && isBinaryPath(artifact.path)
+	if !artifact.isDir && isHTML && ext != ".html" && ext != ".htm" && !coveredByContentCheck {
+		return []remoteFinding{{categoryTypeMismatch, "local file is served as a directory listing (" + contentType + ")"}}
+	}
+	if artifact.isDir && !isHTML && contentType != "" {
+		return []remoteFinding{{categoryTypeMismatch, "local directory is served as a file (" + contentType + ")"}}
+	}
+	return nil
+}
+
+// isForbiddenFile tells entitlement-gated files, which exist but answer 403,
+// apart from missing ones.
+func (r Result) isForbiddenFile() bool {
+	return !r.isDir && r.code == http.StatusForbidden
+}
+
+func (r Result) hasFinding(category string) bool {
+	for _, f := range r.findings {
+		if f.category == category {
+			return true
+		}
+	}
+	return false
+}
+
+// isPresent reports whether code means the artifact exists remotely.
+func isPresent(code int, isDir bool) bool {
+	if !isDir {
+		return code == fileAcceptable
+	}
+	for _, acceptable := range dirsAcceptable {
+		if code == acceptable {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Repository) addFinding(category, path, detail string) {
+	r.findings[category] = append(r.findings[category], Finding{path, detail})
+	if *verbose && categorySelected(category) {
+		log.Printf("%v: %v %v", category, path, detail)
+	}
+}
+
+// duplicates lists the files found in more than one repository group.
+func (r *Repository) duplicates() map[string][]string {
+	duplicates := map[string][]string{}
+	for path, groups := range r.presentIn {
+		if len(groups) > 1 {
+			duplicates[path] = groups
+		}
 	}
+	return duplicates
+}
+
+// account adds result to the per-status and per-top-level-group breakdowns.
+func (r *Repository) account(result Result) {
+	group := strings.SplitN(filepath.ToSlash(result.relPath), "/", 2)[0]
+	r.byStatus[result.status] = r.byStatus[result.status].add(result.elapsed)
+	r.byGroup[group] = r.byGroup[group].add(result.elapsed)
+}
+
+// countExtension tallies a checked file under its extension, prefixed with its
+// classifier when it has one, so -sources.jar is told apart from .jar.
+func (r *Repository) countExtension(result Result, lost bool) {
+	if result.isDir {
+		return
+	}
+	key := strings.ToLower(filepath.Ext(result.relPath))
+	if g, ok := gavFromPath(result.relPath); ok && g.classifier != "" {
+		key = "-" + g.classifier + key
+	}
+	counts := r.byExtension[key]
+	counts.Checked++
+	if lost {
+		counts.Lost++
+	}
+	r.byExtension[key] = counts
+}
+
+func (b breakdown) add(elapsed time.Duration) breakdown {
+	b.Requests++
+	b.Seconds += elapsed.Seconds()
+	return b
+}
+
+// remoteURL joins the remote root, the base path, the repository group and the
+// artifact path, dropping empty segments so no double slashes are produced.
+func remoteURL(root string, group string, relPath string) string {
+	segments := []string{strings.TrimRight(root, "/")}
+	for _, segment := range []string{*remoteBasePath, group, filepath.ToSlash(relPath)} {
+		segment = strings.Trim(segment, "/")
+		if segment != "" && segment != "." {
+			segments = append(segments, segment)
+		}
+	}
+	return strings.Join(segments, "/")
 }
 
 func scan() error {
+	repo.runID = *runID
+	if repo.runID == "" {
+		repo.runID = newRunID()
+	}
+	log.SetPrefix("[" + repo.runID + "] ")
+	repo.startedAt = time.Now()
+	defer func() { repo.finishedAt = time.Now() }()
+
+	if *pinDNSFlag && !*localOnly {
+		if err := pinDNS(context.Background()); err != nil {
+			return err
+		}
+	}
+	client := newHTTPClient()
+	if !*localOnly && !*noPreflight {
+		if err := preflight(client, repoGroups[0]); err != nil {
+			return err
+		}
+	}
+	if !*localOnly && *certExpiry > 0 {
+		checkCertificates(client)
+	}
+
+	if *precountFlag {
+		precount()
+	}
+	events.emit(event{Type: "start"})
+	if *localOnly {
+		return scanLocalOnly()
+	}
+	if *groupConcurrency > 1 && len(repoGroups) > 1 {
+		return scanGroupsConcurrently(client)
+	}
+	for _, group := range repoGroups {
+		if err := scanGroup(context.Background(), client, group, *threads); err != nil {
+			return err
+		}
+		if repo.limitReached {
+			break
+		}
+	}
+	return nil
+}
+
+// scanGroupsConcurrently checks up to --group-concurrency groups at a time.
+// The --threads workers are split between them, so the remote doesn't see
+// more requests in flight than with sequential groups. The first error
+// cancels the other groups.
+func scanGroupsConcurrently(client *http.Client) error {
+	concurrent := *groupConcurrency
+	if concurrent > len(repoGroups) {
+		concurrent = len(repoGroups)
+	}
+	workers := *threads / concurrent
+	if workers < 1 {
+		workers = 1
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	slots := make(chan struct{}, concurrent)
+	errs := make(chan error, len(repoGroups))
+	var wg sync.WaitGroup
+	for _, group := range repoGroups {
+		wg.Add(1)
+		go func(group string) {
+			defer wg.Done()
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-slots }()
+			if err := scanGroup(ctx, client, group, workers); err != nil {
+				errs <- err
+				cancel()
+			}
+		}(group)
+	}
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
+
+// localArtifacts streams the artifacts to check: the --gav paths, the
+// --archive entries or the local walk.
+func localArtifacts(done <-chan struct{}) (<-chan LocalArtifact, <-chan error) {
+	if checkingGAVs() {
+		return listedArtifacts(done, gavPaths())
+	}
+	if *archivePath != "" {
+		return archiveArtifacts(done, *archivePath, *prefix)
+	}
+	if len(mavenRoots) == 1 {
+		return scanLocalPath(done, mavenRoots[0], *prefix)
+	}
+	artifacts := make(chan LocalArtifact)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(artifacts)
+		for _, root := range mavenRoots {
+			rootArtifacts, rootErrs := scanLocalPath(done, root, *prefix)
+			for a := range rootArtifacts {
+				select {
+				case artifacts <- a:
+				case <-done:
+				}
+			}
+			if err := <-rootErrs; err != nil {
+				errs <- err
+				return
+			}
+		}
+		errs <- nil
+	}()
+	return artifacts, errs
+}
+
+func scanLocalOnly() error {
 	done := make(chan struct{})
 	defer close(done)
 
-	artifacts, errs := scanLocalPath(done, "")
+	artifacts, errs := localArtifacts(done)
+	for artifact := range artifacts {
+		if artifact.err != nil {
+			repo.addFinding(categoryLocalReadError, artifact.where(), artifact.err.Error())
+		} else if artifact.emptyDir {
+			repo.addFinding(categoryEmptyDir, artifact.where(), "directory has no files, possibly an interrupted copy")
+		} else if !artifact.isDir {
+			checkLocalArtifact(artifact)
+		}
+	}
+	return <-errs
+}
+
+// scanGroup checks every local artifact against one repository group with the
+// given number of workers, cancelled along with parent. With --group-deadline
+// the group is abandoned once its budget expires and reported as partially
+// checked, leaving the remaining groups their own budget.
+func scanGroup(parent context.Context, client *http.Client, group string, workers int) error {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if *groupDeadline > 0 {
+		ctx, cancel = context.WithTimeout(parent, *groupDeadline)
+	} else {
+		ctx, cancel = context.WithCancel(parent)
+	}
+	defer cancel()
+
+	artifacts, errs := localArtifacts(ctx.Done())
 	res := make(chan Result)
 	var wg sync.WaitGroup
-	wg.Add(*threads)
-	for i := 0; i < *threads; i++ {
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
 		go func() {
-			scanRemotePath(done, artifacts, res)
+			scanRemotePath(ctx, client, group, artifacts, res)
 			wg.Done()
 		}()
 	}
@@ -184,37 +1210,39 @@ func scan() error {
 		close(res)
 	}()
 
-	for r := range res {
-		if r.err != nil {
-			return r.err
-		}
-		dirsAcceptable := []int{200, 301, 302}
-		fileAcceptable := 200
-		var msg string
-		msg = fmt.Sprintf("artifact: %v status: %v", r.path, r.status)
-		if r.isDir {
-			for _,  code := range dirsAcceptable {
-				if code == r.code {
-					break
-				} else {
-					repo.lostDirs = append(repo.lostDirs, r.path)
-					msg = fmt.Sprintf("Dir %v is lost. Code: %v vs %v", r.path, r.code, code)
-				}
-			}
-		} else {
-			if fileAcceptable != r.code {
-				repo.lostFiles = append(repo.lostFiles, r.path)
-				msg = fmt.Sprintf("File %v is lost. Code: %v vs %v", r.path, r.code, fileAcceptable)
-			}
-		}
-		
-		if *verbose {
-			log.Println(msg)
-		}
+	c := newCollector(group)
+	if err := <-c.collect(ctx, cancel, res); err != nil {
+		return err
+	}
+	if c.stalled {
+		<-errs
+		repo.setGroupStatus(group, fmt.Sprintf("partial, stalled for %v", *stallTimeout))
+		return nil
+	}
+	if parent.Err() != nil {
+		// Another group failed, the run is over.
+		<-errs
+		repo.setGroupStatus(group, "partial, cancelled")
+		return nil
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		<-errs
+		repo.setGroupStatus(group, fmt.Sprintf("partial, deadline of %v exceeded", *groupDeadline))
+		return nil
+	}
+	if *limit > 0 && atomic.LoadInt64(&remoteChecks) > *limit {
+		// Every result was collected, only the walk is left to stop.
+		cancel()
+		<-errs
+		repoMu.Lock()
+		repo.limitReached = true
+		repoMu.Unlock()
+		repo.setGroupStatus(group, fmt.Sprintf("partial, limit of %v artifacts reached", *limit))
+		return nil
 	}
-
 	if err := <- errs; err != nil {
 		return err
 	}
+	repo.setGroupStatus(group, "complete")
 	return nil
 }
@@ -0,0 +1,771 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// resetRun puts every flag back to its default and forgets what an earlier
+// run left behind, so each test starts as a fresh process would. It does so
+// again once the test is over, for the tests that don't reset.
+func resetRun(t testing.TB) {
+	t.Helper()
+	resetState()
+	t.Cleanup(resetState)
+}
+
+func resetState() {
+	flag.VisitAll(func(f *flag.Flag) {
+		if !strings.HasPrefix(f.Name, "test.") {
+			f.Value.Set(f.DefValue)
+		}
+	})
+	mavenRoots, nexusRoots, classifiers, pathRewrites = nil, nil, nil, rewriteRules{}
+	repo, repoGroups, gavTargets, sinceTime = Repository{}, nil, nil, time.Time{}
+	onlyCategories = map[string]bool{}
+	checksumAlgorithms = map[string]bool{}
+	trustedFiles, manifestDigests = map[string]map[string]bool{}, digests{}
+	baselineResults, newlyLost, newlyMismatched, recovered = nil, 0, 0, 0
+	artifactAges = ageIndex{versions: map[string]map[string]*versionAge{}}
+	identicalFiles = contentIndex{paths: map[string]map[string]bool{}, sizes: map[string]int64{}}
+	snapshots = snapshotResolver{lookups: map[string]*snapshotLookup{}}
+	allowedHostSet, pinnedHosts, clientCertificates = map[string]bool{}, map[string][]string{}, nil
+	workerSlots, batches, lines, events, quietLog = nil, nil, nil, nil, nil
+	headUnsupported, outputLocation, pause.until = false, time.Local, time.Time{}
+	log.SetPrefix("")
+	atomic.StoreInt64(&walked, 0)
+	atomic.StoreInt64(&precounted, 0)
+	atomic.StoreInt64(&remoteChecks, 0)
+	atomic.StoreInt64(&retriesUsed, 0)
+	atomic.StoreInt64(&bytesTransferred, 0)
+	atomic.StoreInt32(&retryBudgetExhausted, 0)
+}
+
+// runCrawler runs a check with the given command line, the way main does up
+// to the reports, with the log discarded.
+func runCrawler(t testing.TB, args ...string) error {
+	t.Helper()
+	resetRun(t)
+	defer func(args []string) { os.Args = args }(os.Args)
+	os.Args = append([]string{"nexus_crawler"}, args...)
+	parseFlags()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return scan()
+}
+
+// writeTree creates the files below dir, keyed by their slash separated path.
+func writeTree(t testing.TB, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// serveTree serves dir the way a Nexus repository would serve its files,
+// counting the requests.
+func serveTree(t testing.TB, dir string) (*httptest.Server, *int64) {
+	t.Helper()
+	var requests int64
+	files := http.FileServer(http.Dir(dir))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		files.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+// mirrorTree writes versions artifacts to local and, but for the first one,
+// to remote too.
+func mirrorTree(t testing.TB, local string, remote string, versions int) {
+	t.Helper()
+	files := map[string]string{}
+	for v := 0; v < versions; v++ {
+		files[fmt.Sprintf("org/e/lib/%[1]v/lib-%[1]v.jar", v)] = "jar content"
+		files[fmt.Sprintf("org/e/lib/%[1]v/lib-%[1]v.pom", v)] = "<project/>"
+	}
+	writeTree(t, local, files)
+	writeTree(t, remote, files)
+	if err := os.RemoveAll(filepath.Join(remote, "org/e/lib/0")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// findingPaths lists the paths of the findings of category, sorted.
+func findingPaths(category string) []string {
+	var paths []string
+	for _, f := range repo.findings[category] {
+		paths = append(paths, filepath.ToSlash(f.path))
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func md5Hex(content string) string {
+	sum := md5.Sum([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func sha1Hex(content string) string {
+	sum := sha1.Sum([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestLocalOnlyReportsLocalCorruptionWithoutHTTP(t *testing.T) {
+	local := t.TempDir()
+	writeTree(t, local, map[string]string{
+		"org/e/lib/1.0/lib-1.0.jar":         "jar content",
+		"org/e/lib/1.0/lib-1.0.jar.md5":     md5Hex("other content"),
+		"org/e/lib/1.0/lib-1.0.jar.sha1":    sha1Hex("jar content"),
+		"org/e/lib/1.0/lib-1.0.pom":         "<project><modelVersion>4.0.0",
+		"org/e/lib/1.0/lib-1.0-sources.jar": "",
+	})
+	server, requests := serveTree(t, t.TempDir())
+	if err := runCrawler(t, "--maven-repository", local, "--nexus-root", server.URL, "--local-only"); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt64(requests); n != 0 {
+		t.Errorf("--local-only sent %v requests", n)
+	}
+	want := map[string][]string{
+		categoryLocalChecksum: {"org/e/lib/1.0/lib-1.0.jar"},
+		categoryInvalidPom:    {"org/e/lib/1.0/lib-1.0.pom"},
+		categoryZeroByte:      {"org/e/lib/1.0/lib-1.0-sources.jar"},
+	}
+	for category, paths := range want {
+		if got := findingPaths(category); strings.Join(got, ",") != strings.Join(paths, ",") {
+			t.Errorf("%v findings = %v, want %v", category, got, paths)
+		}
+	}
+	if !hasFailures() {
+		t.Error("local corruption should fail the run")
+	}
+}
+
+func TestLocalOnlyPassesConsistentTree(t *testing.T) {
+	local := t.TempDir()
+	writeTree(t, local, map[string]string{
+		"org/e/lib/1.0/lib-1.0.jar":      "jar content",
+		"org/e/lib/1.0/lib-1.0.jar.md5":  md5Hex("jar content") + "\n",
+		"org/e/lib/1.0/lib-1.0.jar.sha1": strings.ToUpper(sha1Hex("jar content")),
+		"org/e/lib/1.0/lib-1.0.pom":      "<project><artifactId>lib</artifactId><version>1.0</version></project>",
+	})
+	if err := runCrawler(t, "--maven-repository", local, "--local-only"); err != nil {
+		t.Fatal(err)
+	}
+	for category, findings := range repo.findings {
+		t.Errorf("unexpected %v findings: %v", category, findings)
+	}
+}
+
+func TestRemoteURLJoinsBasePath(t *testing.T) {
+	resetRun(t)
+	for _, test := range []struct {
+		root, basePath, group, relPath, want string
+	}{
+		{"https://nexus", "", "ga", "org/e/lib", "https://nexus/ga/org/e/lib"},
+		{"https://nexus/", "content/repositories", "ga", "org/e/lib", "https://nexus/content/repositories/ga/org/e/lib"},
+		{"https://nexus", "/nexus/content/repositories/", "/ga/", "/org/e/lib", "https://nexus/nexus/content/repositories/ga/org/e/lib"},
+	} {
+		*remoteBasePath = test.basePath
+		if got := remoteURL(test.root, test.group, test.relPath); got != test.want {
+			t.Errorf("remoteURL(%q, %q, %q) with --remote-base-path %q = %v, want %v", test.root, test.group, test.relPath, test.basePath, got, test.want)
+		}
+	}
+}
+
+func TestCompareRemoteReportsDisagreements(t *testing.T) {
+	local, primary, second := t.TempDir(), t.TempDir(), t.TempDir()
+	files := map[string]string{
+		"org/e/lib/1.0/lib-1.0.jar": "jar content",
+		"org/e/lib/2.0/lib-2.0.jar": "jar content",
+	}
+	writeTree(t, local, files)
+	writeTree(t, primary, files)
+	writeTree(t, second, map[string]string{"org/e/lib/1.0/lib-1.0.jar": "jar content"})
+	primaryServer, _ := serveTree(t, primary)
+	secondServer, _ := serveTree(t, second)
+	if err := runCrawler(t, "--maven-repository", local, "--nexus-root", primaryServer.URL, "--repository-name", "", "--compare-remote", secondServer.URL); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{primaryServer.URL + "/org/e/lib/2.0", primaryServer.URL + "/org/e/lib/2.0/lib-2.0.jar"}
+	if got := findingPaths(categoryMirrorMismatch); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("mirror-mismatch findings = %v, want %v", got, want)
+	}
+}
+
+func TestUnreadableFileIsReportedAndWalkGoesOn(t *testing.T) {
+	local, remote := t.TempDir(), t.TempDir()
+	mirrorTree(t, local, remote, 2)
+	// A dangling symlink can't be read even by root, unlike a chmod 0 file.
+	unreadable := filepath.Join(local, "org/e/lib/1/lib-1.jar")
+	if err := os.Remove(unreadable); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(local, "absent.jar"), unreadable); err != nil {
+		t.Fatal(err)
+	}
+	server, _ := serveTree(t, remote)
+	if err := runCrawler(t, "--maven-repository", local, "--nexus-root", server.URL, "--repository-name", "", "--md5Sum"); err != nil {
+		t.Fatal(err)
+	}
+	if got := findingPaths(categoryLocalReadError); len(got) != 1 || got[0] != "org/e/lib/1/lib-1.jar" {
+		t.Errorf("local-read-error findings = %v", got)
+	}
+	// Everything else is still checked: the lost version 0 and the POM next to
+	// the unreadable jar.
+	if len(repo.lostFiles) != 2 || checkedCount() != 4+2*3-1 {
+		t.Errorf("checked %v, lost %v", checkedCount(), repo.lostFiles)
+	}
+}
+
+func TestTypeMismatchBetweenFilesAndDirectories(t *testing.T) {
+	local, remote := t.TempDir(), t.TempDir()
+	writeTree(t, local, map[string]string{
+		"org/e/lib/1.0/lib-1.0.jar": "jar content",
+		"org/e/lib/2.0/lib-2.0.pom": "<project/>",
+	})
+	writeTree(t, remote, map[string]string{
+		// A directory where the jar should be, served as an HTML index.
+		"org/e/lib/1.0/lib-1.0.jar/index.txt": "listing",
+		// A file where the version directory should be.
+		"org/e/lib/2.0": "not a directory",
+	})
+	server, _ := serveTree(t, remote)
+	if err := runCrawler(t, "--maven-repository", local, "--nexus-root", server.URL, "--repository-name", ""); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{server.URL + "/org/e/lib/1.0/lib-1.0.jar", server.URL + "/org/e/lib/2.0"}
+	if got := findingPaths(categoryTypeMismatch); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("type-mismatch findings = %v, want %v", got, want)
+	}
+}
+
+func TestForbiddenFiles(t *testing.T) {
+	local, remote := t.TempDir(), t.TempDir()
+	files := map[string]string{
+		"org/e/lib/1.0/lib-1.0.jar":         "jar content",
+		"org/e/lib/1.0/lib-1.0-sources.jar": "sources",
+	}
+	writeTree(t, local, files)
+	writeTree(t, remote, files)
+	tree := http.FileServer(http.Dir(remote))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "-sources.jar") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		tree.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	args := []string{"--maven-repository", local, "--nexus-root", server.URL, "--repository-name", ""}
+
+	if err := runCrawler(t, args...); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{server.URL + "/org/e/lib/1.0/lib-1.0-sources.jar"}
+	if got := findingPaths(categoryForbidden); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("forbidden findings = %v, want %v", got, want)
+	}
+	if len(repo.lostFiles) != 0 || hasFailures() {
+		t.Errorf("a forbidden file is lost %v or fails the run", repo.lostFiles)
+	}
+
+	if err := runCrawler(t, append(args, "--forbidden-is-ok")...); err != nil {
+		t.Fatal(err)
+	}
+	if got := findingPaths(categoryForbidden); len(got) != 0 || repo.present != checkedCount() {
+		t.Errorf("with --forbidden-is-ok, forbidden findings = %v, %v of %v present", got, repo.present, checkedCount())
+	}
+}
+
+func TestDuplicatesAcrossGroups(t *testing.T) {
+	local, remote := t.TempDir(), t.TempDir()
+	writeTree(t, local, map[string]string{
+		"org/e/lib/1.0/lib-1.0.jar": "jar content",
+		"org/e/lib/1.0/lib-1.0.pom": "<project/>",
+	})
+	writeTree(t, remote, map[string]string{
+		"releases/org/e/lib/1.0/lib-1.0.jar":   "jar content",
+		"releases/org/e/lib/1.0/lib-1.0.pom":   "<project/>",
+		"thirdparty/org/e/lib/1.0/lib-1.0.jar": "jar content",
+	})
+	server, _ := serveTree(t, remote)
+	if err := runCrawler(t, "--maven-repository", local, "--nexus-root", server.URL, "--repository-name", "releases,thirdparty"); err != nil {
+		t.Fatal(err)
+	}
+	duplicates := repo.duplicates()
+	jar := filepath.FromSlash("org/e/lib/1.0/lib-1.0.jar")
+	if len(duplicates) != 1 || strings.Join(duplicates[jar], ",") != "releases,thirdparty" {
+		t.Errorf("duplicates = %v, want the jar in releases and thirdparty", duplicates)
+	}
+}
+
+func TestValidateMavenRepoRejectsInvalidRoots(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "settings.xml")
+	empty := filepath.Join(dir, "empty")
+	writeTree(t, dir, map[string]string{"settings.xml": "<settings/>", "repository/org/e/lib/1.0/lib-1.0.jar": "jar"})
+	if err := os.Mkdir(empty, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for root, want := range map[string]string{
+		filepath.Join(dir, "absent"): "does not exist",
+		file:                         "is not a directory",
+		empty:                        "nothing to scan",
+	} {
+		if err := validateMavenRepo(root); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("validateMavenRepo(%v) = %v, want %q", root, err, want)
+		}
+	}
+	if err := validateMavenRepo(filepath.Join(dir, "repository")); err != nil {
+		t.Errorf("validateMavenRepo of a repository: %v", err)
+	}
+}
+
+// TestMainProcess runs main with the arguments after "--" when a test starts
+// it as a child process through runMain.
+func TestMainProcess(t *testing.T) {
+	if os.Getenv("CRAWLER_TEST_MAIN") != "1" {
+		return
+	}
+	for i, arg := range os.Args {
+		if arg == "--" {
+			os.Args = append([]string{"nexus_crawler"}, os.Args[i+1:]...)
+			break
+		}
+	}
+	main()
+	os.Exit(0)
+}
+
+// runMain runs main in a child process and returns its exit code and output.
+func runMain(t *testing.T, args ...string) (int, string) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], append([]string{"-test.run=^TestMainProcess$", "--"}, args...)...)
+	cmd.Env = append(os.Environ(), "CRAWLER_TEST_MAIN=1")
+	output, err := cmd.CombinedOutput()
+	if exit, ok := err.(*exec.ExitError); ok {
+		return exit.ExitCode(), string(output)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return 0, string(output)
+}
+
+func TestInvalidMavenRepoExitsWith3(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "settings.xml")
+	writeTree(t, filepath.Dir(file), map[string]string{"settings.xml": "<settings/>"})
+	code, output := runMain(t, "--maven-repository", file)
+	if code != 3 || !strings.Contains(output, "is not a directory") {
+		t.Errorf("exit code %v, output %q", code, output)
+	}
+}
+
+func TestCanonicalizeRedirectsReportsTarget(t *testing.T) {
+	local := t.TempDir()
+	writeTree(t, local, map[string]string{"org/e/lib/1.0/lib-1.0.jar": "jar content"})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/org/e/lib/1.0" {
+			http.Redirect(w, r, "http://mirror.example/org/e/lib/1.0/", http.StatusFound)
+		}
+	}))
+	defer server.Close()
+	if err := runCrawler(t, "--maven-repository", local, "--nexus-root", server.URL, "--repository-name", "", "--canonicalize-redirects"); err != nil {
+		t.Fatal(err)
+	}
+	findings := repo.findings[categoryRedirect]
+	if len(findings) != 1 || findings[0].path != server.URL+"/org/e/lib/1.0" ||
+		findings[0].detail != "redirects to http://mirror.example/org/e/lib/1.0/ on unexpected host mirror.example" {
+		t.Errorf("redirect findings = %v", findings)
+	}
+	if len(repo.lostDirs) != 0 {
+		t.Errorf("the redirected directory was lost: %v", repo.lostDirs)
+	}
+}
+
+func TestGroupDeadlineLeavesOtherGroupsTheirBudget(t *testing.T) {
+	local, remote := t.TempDir(), t.TempDir()
+	mirrorTree(t, local, filepath.Join(remote, "fast"), 3)
+	tree := http.FileServer(http.Dir(remote))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/slow/") {
+			select {
+			case <-time.After(5 * time.Second):
+			case <-r.Context().Done():
+			}
+			return
+		}
+		tree.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	start := time.Now()
+	if err := runCrawler(t, "--maven-repository", local, "--nexus-root", server.URL, "--repository-name", "slow,fast",
+		"--group-deadline", "300ms", "--no-preflight"); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("the run took %v despite the 300ms group deadline", elapsed)
+	}
+	if status := repo.groupStatus["slow"]; status != "partial, deadline of 300ms exceeded" {
+		t.Errorf("slow group status = %q", status)
+	}
+	if status := repo.groupStatus["fast"]; status != "complete" {
+		t.Errorf("fast group status = %q", status)
+	}
+	if repo.notChecked == 0 {
+		t.Error("the artifacts of the slow group in flight weren't counted as not checked")
+	}
+}
+
+func TestEmptyVersionDirectoryIsReported(t *testing.T) {
+	local, remote := t.TempDir(), t.TempDir()
+	mirrorTree(t, local, remote, 2)
+	if err := os.MkdirAll(filepath.Join(local, "org/e/lib/2"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	server, _ := serveTree(t, remote)
+	if err := runCrawler(t, "--maven-repository", local, "--nexus-root", server.URL, "--repository-name", ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := findingPaths(categoryEmptyDir); len(got) != 1 || got[0] != "org/e/lib/2" {
+		t.Errorf("empty-dir findings = %v", got)
+	}
+	if err := runCrawler(t, "--maven-repository", local, "--local-only"); err != nil {
+		t.Fatal(err)
+	}
+	if got := findingPaths(categoryEmptyDir); len(got) != 1 || got[0] != "org/e/lib/2" {
+		t.Errorf("--local-only empty-dir findings = %v", got)
+	}
+}
+
+func TestEmptyRepositoryNameOmitsSegment(t *testing.T) {
+	for names, want := range map[string]string{"": "", " , /": "", "ga": "ga", "/releases/, thirdparty": "releases,thirdparty"} {
+		if got := strings.Join(parseRepoGroups(names), ","); got != want {
+			t.Errorf("parseRepoGroups(%q) = %q, want %q", names, got, want)
+		}
+	}
+
+	local, remote := t.TempDir(), t.TempDir()
+	mirrorTree(t, local, remote, 2)
+	tree := http.FileServer(http.Dir(remote))
+	var doubled int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "//") {
+			atomic.AddInt64(&doubled, 1)
+		}
+		tree.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	if err := runCrawler(t, "--maven-repository", local, "--nexus-root", server.URL+"/", "--repository-name", ""); err != nil {
+		t.Fatal(err)
+	}
+	if doubled != 0 {
+		t.Errorf("%v requests had a double slash", doubled)
+	}
+	if len(repo.lostFiles) != 2 || repo.present != checkedCount()-3 {
+		t.Errorf("lost %v, %v of %v present, want only version 0 lost", repo.lostFiles, repo.present, checkedCount())
+	}
+}
+
+func TestLimitChecksExactlyN(t *testing.T) {
+	local, remote := t.TempDir(), t.TempDir()
+	mirrorTree(t, local, remote, 50)
+	tree := http.FileServer(http.Dir(remote))
+	var checks int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Not counting the redirects of the file server to the directories with
+		// a trailing slash.
+		if r.URL.Path == "/" || !strings.HasSuffix(r.URL.Path, "/") {
+			atomic.AddInt64(&checks, 1)
+		}
+		tree.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	if err := runCrawler(t, "--maven-repository", local, "--nexus-root", server.URL, "--repository-name", "",
+		"--limit", "10", "--threads", "16", "--no-preflight"); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt64(&checks); n != 10 || checkedCount() != 10 {
+		t.Errorf("--limit 10 sent %v requests and checked %v artifacts", n, checkedCount())
+	}
+	if !repo.limitReached || repo.groupStatus[""] != "partial, limit of 10 artifacts reached" {
+		t.Errorf("limit reached %v, group status %q", repo.limitReached, repo.groupStatus[""])
+	}
+}
+
+func TestPrefixScansOnlyTheSubtree(t *testing.T) {
+	local, remote := t.TempDir(), t.TempDir()
+	writeTree(t, local, map[string]string{
+		"org/e/lib/1.0/lib-1.0.jar":     "jar content",
+		"org/e/lib/1.0/lib-1.0.pom":     "<project/>",
+		"org/other/lib/1.0/lib-1.0.jar": "jar content",
+		"com/x/app/1.0/app-1.0.jar":     "jar content",
+	})
+	writeTree(t, remote, map[string]string{
+		"org/e/lib/1.0/lib-1.0.jar": "jar content",
+		"org/e/lib/1.0/lib-1.0.pom": "<project/>",
+	})
+	tree := http.FileServer(http.Dir(remote))
+	var outside int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/org/e" && !strings.HasPrefix(r.URL.Path, "/org/e/") {
+			atomic.AddInt64(&outside, 1)
+		}
+		tree.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	if err := runCrawler(t, "--maven-repository", local, "--nexus-root", server.URL, "--repository-name", "",
+		"--prefix", "org/e/", "--no-preflight"); err != nil {
+		t.Fatal(err)
+	}
+	if outside != 0 {
+		t.Errorf("%v requests outside of --prefix org/e", outside)
+	}
+	// org/e itself, org/e/lib, its version and the 2 files.
+	if walked != 5 || len(repo.lostDirs) != 0 || len(repo.lostFiles) != 0 || repo.present != checkedCount() {
+		t.Errorf("walked %v, lost %v and %v, %v of %v present", walked, repo.lostDirs, repo.lostFiles, repo.present, checkedCount())
+	}
+
+	for _, prefix := range []string{"../org", "/org/e", "org/absent", "org/e/lib/1.0/lib-1.0.jar"} {
+		if err := validatePrefix(local, prefix); err == nil {
+			t.Errorf("validatePrefix accepted --prefix %v", prefix)
+		}
+	}
+}
+
+func TestSinceSkipsOldFiles(t *testing.T) {
+	local, remote := t.TempDir(), t.TempDir()
+	mirrorTree(t, local, remote, 3)
+	old := time.Now().Add(-48 * time.Hour)
+	// Version 0, absent remotely, is old and so isn't checked again.
+	for _, name := range []string{"org/e/lib/0/lib-0.jar", "org/e/lib/0/lib-0.pom", "org/e/lib/1/lib-1.pom"} {
+		if err := os.Chtimes(filepath.Join(local, name), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	server, _ := serveTree(t, remote)
+	if err := runCrawler(t, "--maven-repository", local, "--nexus-root", server.URL, "--repository-name", "", "--since", "24h"); err != nil {
+		t.Fatal(err)
+	}
+	if len(repo.lostFiles) != 0 {
+		t.Errorf("old files were checked: %v", repo.lostFiles)
+	}
+	// The 7 directories are still checked, and the 3 recent files.
+	if checkedCount() != 7+3 || len(repo.lostDirs) != 1 {
+		t.Errorf("checked %v, lost dirs %v", checkedCount(), repo.lostDirs)
+	}
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.Local)
+	for value, want := range map[string]time.Time{
+		"36h":                  now.Add(-36 * time.Hour),
+		"2024-02-01":           time.Date(2024, 2, 1, 0, 0, 0, 0, time.Local),
+		"2024-02-01T10:00:00Z": time.Date(2024, 2, 1, 10, 0, 0, 0, time.UTC),
+	} {
+		if got, err := parseSince(value, now); err != nil || !got.Equal(want) {
+			t.Errorf("parseSince(%q) = %v, %v, want %v", value, got, err, want)
+		}
+	}
+	if _, err := parseSince("yesterday", now); err == nil {
+		t.Error("parseSince accepted yesterday")
+	}
+}
+
+func TestThreadsAreValidatedAndCapped(t *testing.T) {
+	local, remote := t.TempDir(), t.TempDir()
+	mirrorTree(t, local, remote, 2)
+	code, output := runMain(t, "--maven-repository", local, "--threads", "0")
+	if code != 3 || !strings.Contains(output, "--threads must be at least 1") {
+		t.Errorf("--threads 0 exited with %v, output %q", code, output)
+	}
+
+	server, _ := serveTree(t, remote)
+	_, output = runMain(t, "--maven-repository", local, "--nexus-root", server.URL, "--repository-name", "", "--threads", "1000000")
+	want := fmt.Sprintf("--threads 1000000 is more than %v per CPU, capping it to %v", maxThreadsPerCPU, maxThreadsPerCPU*runtime.GOMAXPROCS(0))
+	if !strings.Contains(output, want) {
+		t.Errorf("--threads 1000000 output %q, want the warning %q", output, want)
+	}
+}
+
+func TestDirCheckModes(t *testing.T) {
+	local, remote := t.TempDir(), t.TempDir()
+	mirrorTree(t, local, remote, 2)
+	tree := http.FileServer(http.Dir(remote))
+	var mu sync.Mutex
+	requested := map[string]bool{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested[r.URL.Path] = true
+		mu.Unlock()
+		tree.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	files := []string{"/org/e/lib/0/lib-0.jar", "/org/e/lib/0/lib-0.pom", "/org/e/lib/1/lib-1.jar", "/org/e/lib/1/lib-1.pom"}
+	for mode, dirs := range map[string][]string{
+		"all":  {"/", "/org", "/org/e", "/org/e/lib", "/org/e/lib/0", "/org/e/lib/1"},
+		"leaf": {"/org/e/lib/0", "/org/e/lib/1"},
+		"none": nil,
+	} {
+		mu.Lock()
+		requested = map[string]bool{}
+		mu.Unlock()
+		if err := runCrawler(t, "--maven-repository", local, "--nexus-root", server.URL, "--repository-name", "",
+			"--dir-check", mode, "--no-preflight"); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for p := range requested {
+			// Not the redirects of the file server to the directories with a slash.
+			if p == "/" || !strings.HasSuffix(p, "/") {
+				got = append(got, p)
+			}
+		}
+		sort.Strings(got)
+		want := append(append([]string{}, dirs...), files...)
+		sort.Strings(want)
+		if strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Errorf("--dir-check %v requested %v, want %v", mode, got, want)
+		}
+	}
+}
+
+func TestSeveralMavenRepositoryRoots(t *testing.T) {
+	first, second, remote := t.TempDir(), t.TempDir(), t.TempDir()
+	shared := map[string]string{"org/e/lib/1.0/lib-1.0.jar": "jar content"}
+	writeTree(t, first, shared)
+	writeTree(t, second, shared)
+	writeTree(t, remote, shared)
+	writeTree(t, first, map[string]string{"org/e/lib/2.0/lib-2.0.jar": "jar content"})
+	writeTree(t, second, map[string]string{
+		"org/e/app/1.0/app-1.0.jar": "jar content",
+		"org/e/app/1.0/app-1.0.pom": "",
+	})
+	server, _ := serveTree(t, remote)
+	if err := runCrawler(t, "--maven-repository", first, "--maven-repository", second, "--nexus-root", server.URL, "--repository-name", ""); err != nil {
+		t.Fatal(err)
+	}
+	lib, app := server.URL+"/org/e/lib/2.0/lib-2.0.jar", server.URL+"/org/e/app/1.0/app-1.0"
+	want := map[string][]string{first: {lib}, second: {app + ".jar", app + ".pom"}}
+	for root, files := range repo.lostByRoot {
+		sort.Strings(files)
+		repo.lostByRoot[root] = files
+	}
+	if !reflect.DeepEqual(repo.lostByRoot, want) {
+		t.Errorf("lost by root = %v, want %v", repo.lostByRoot, want)
+	}
+
+	// The local findings name the root of the file.
+	if err := runCrawler(t, "--maven-repository", first, "--maven-repository", second, "--local-only"); err != nil {
+		t.Fatal(err)
+	}
+	zeroByte := filepath.ToSlash(filepath.Join(second, "org/e/app/1.0/app-1.0.pom"))
+	if got := findingPaths(categoryZeroByte); len(got) != 1 || got[0] != zeroByte {
+		t.Errorf("zero-byte findings = %v, want %v", got, zeroByte)
+	}
+}
+
+func TestFileRemoteComparesTwoTrees(t *testing.T) {
+	local, staged := t.TempDir(), t.TempDir()
+	mirrorTree(t, local, staged, 3)
+	writeTree(t, local, map[string]string{"org/e/lib/1/lib-1.jar.sha1": sha1Hex("jar content")})
+	writeTree(t, staged, map[string]string{
+		"org/e/lib/1/lib-1.jar.sha1": sha1Hex("jar content"),
+		"org/e/lib/2/lib-2.jar":      "truncated",
+		"org/e/lib/2/lib-2.jar.sha1": sha1Hex("truncated"),
+	})
+	if err := runCrawler(t, "--maven-repository", local, "--nexus-root", "file://"+filepath.ToSlash(staged), "--repository-name", "", "--sha1Sum"); err != nil {
+		t.Fatal(err)
+	}
+	root := "file://" + filepath.ToSlash(staged) + "/org/e/lib/"
+	sort.Strings(repo.lostFiles)
+	if got := strings.Join(repo.lostFiles, " "); len(repo.lostDirs) != 1 || got != root+"0/lib-0.jar "+root+"0/lib-0.pom" {
+		t.Errorf("lost %v and %v, want version 0", repo.lostDirs, repo.lostFiles)
+	}
+	if got := findingPaths(categoryChecksumMismatch); len(got) != 1 || got[0] != root+"2/lib-2.jar" {
+		t.Errorf("checksum-mismatch findings = %v, want the truncated jar", got)
+	}
+}
+
+func TestMirrorsFallBackInOrder(t *testing.T) {
+	local, first, second := t.TempDir(), t.TempDir(), t.TempDir()
+	mirrorTree(t, local, t.TempDir(), 3)
+	// Version 0 is on neither mirror, 1 is on the first and 2 on the second only.
+	writeTree(t, first, map[string]string{"org/e/lib/1/lib-1.jar": "jar content", "org/e/lib/1/lib-1.pom": "<project/>"})
+	writeTree(t, second, map[string]string{"org/e/lib/2/lib-2.jar": "jar content", "org/e/lib/2/lib-2.pom": "<project/>"})
+	firstServer, _ := serveTree(t, first)
+	secondServer, _ := serveTree(t, second)
+	if err := runCrawler(t, "--maven-repository", local, "--nexus-root", firstServer.URL, "--nexus-root", secondServer.URL, "--repository-name", ""); err != nil {
+		t.Fatal(err)
+	}
+	if len(repo.lostDirs) != 1 || len(repo.lostFiles) != 2 || repo.present != checkedCount()-3 {
+		t.Errorf("lost %v and %v, %v of %v present, want only version 0 lost", repo.lostDirs, repo.lostFiles, repo.present, checkedCount())
+	}
+	if served := repo.servedBy[secondServer.URL]; served != 3 || len(repo.servedBy) != 1 {
+		t.Errorf("served by = %v, want version 2 and its files from the second mirror", repo.servedBy)
+	}
+
+	// A first mirror that doesn't answer at all is fallen back from too.
+	dead := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	dead.Close()
+	if err := runCrawler(t, "--maven-repository", local, "--nexus-root", dead.URL, "--nexus-root", secondServer.URL, "--repository-name", "",
+		"--no-preflight"); err != nil {
+		t.Fatal(err)
+	}
+	if len(repo.lostFiles) != 4 || repo.servedBy[secondServer.URL] != 4+3 {
+		t.Errorf("with a dead first mirror, lost %v, served by %v", repo.lostFiles, repo.servedBy)
+	}
+}
+
+func TestValidateNexusRoot(t *testing.T) {
+	for root, want := range map[string]string{
+		"https://maven.example.com/":     "https://maven.example.com",
+		"http://nexus:8081/repository//": "http://nexus:8081/repository",
+		"https://maven.example.com":      "https://maven.example.com",
+		"file:///srv/mirror/":            "file:///srv/mirror",
+	} {
+		if got, err := validateNexusRoot(root); err != nil || got != want {
+			t.Errorf("validateNexusRoot(%q) = %q, %v, want %q", root, got, err, want)
+		}
+	}
+	for root, want := range map[string]string{
+		"maven.example.com":    "did you mean https://maven.example.com?",
+		"ftp://maven.example":  "must be an absolute http:// or https:// URL",
+		"https:///no/host":     "must be an absolute http:// or https:// URL",
+		"https://maven.ex%zz/": "is not a URL",
+	} {
+		if _, err := validateNexusRoot(root); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("validateNexusRoot(%q) error %v, want %q", root, err, want)
+		}
+	}
+	local := t.TempDir()
+	writeTree(t, local, map[string]string{"org/e/lib/1.0/lib-1.0.jar": "jar content"})
+	if code, output := runMain(t, "--maven-repository", local, "--nexus-root", "maven.example.com"); code != 3 || !strings.Contains(output, "has no scheme") {
+		t.Errorf("exit code %v, output %q", code, output)
+	}
+}
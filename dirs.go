@@ -0,0 +1,63 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// openDir is a directory the walk is still inside of.
+type openDir struct {
+	artifact   LocalArtifact
+	path       string
+	hasFiles   bool
+	hasSubdirs bool
+}
+
+// dirTracker holds directory artifacts back until the walk leaves them, so they
+// are emitted knowing whether anything was found beneath them.
+type dirTracker struct {
+	open []*openDir
+}
+
+// visit records that the walk reached path and returns the directories it has
+// left on the way.
+func (t *dirTracker) visit(path string, isDir bool) []LocalArtifact {
+	var left []LocalArtifact
+	for len(t.open) > 0 {
+		top := t.open[len(t.open)-1]
+		if path == top.path || strings.HasPrefix(path, top.path+string(filepath.Separator)) {
+			break
+		}
+		left = append(left, t.pop())
+	}
+	if len(t.open) > 0 && isDir {
+		t.open[len(t.open)-1].hasSubdirs = true
+	}
+	if !isDir {
+		for _, dir := range t.open {
+			dir.hasFiles = true
+		}
+	}
+	return left
+}
+
+func (t *dirTracker) push(artifact LocalArtifact, path string) {
+	t.open = append(t.open, &openDir{artifact: artifact, path: path})
+}
+
+func (t *dirTracker) pop() LocalArtifact {
+	dir := t.open[len(t.open)-1]
+	t.open = t.open[:len(t.open)-1]
+	dir.artifact.emptyDir = !dir.hasFiles && !dir.hasSubdirs
+	dir.artifact.leafDir = !dir.hasSubdirs
+	return dir.artifact
+}
+
+// close returns the directories still open once the walk is over.
+func (t *dirTracker) close() []LocalArtifact {
+	var left []LocalArtifact
+	for len(t.open) > 0 {
+		left = append(left, t.pop())
+	}
+	return left
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// pinnedHosts maps the remote host names to the addresses resolved once with
+// --pin-dns, so a name rotated by a load balancer mid-crawl keeps answering
+// from the same backends.
+var pinnedHosts = map[string][]string{}
+
+// pinDNS resolves the hosts of --nexus-root and --compare-remote before the
+// crawl. A host that doesn't resolve fails the run up front rather than every
+// request.
+func pinDNS(ctx context.Context) error {
+	for _, remote := range append(nexusRoots[:len(nexusRoots):len(nexusRoots)], *compareRemote) {
+		u, err := url.Parse(remote)
+		if remote == "" || err != nil || u.Scheme == "file" {
+			continue
+		}
+		host := u.Hostname()
+		if _, ok := pinnedHosts[host]; ok || net.ParseIP(host) != nil {
+			continue
+		}
+		addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+		if err != nil {
+			return fmt.Errorf("Cannot resolve %v: %v", host, err)
+		}
+		log.Printf("Pinned %v to %v", host, strings.Join(addrs, ", "))
+		pinnedHosts[host] = addrs
+	}
+	return nil
+}
+
+// pinnedDialer dials the addresses pinned for a host in order, until one
+// answers. Other hosts, such as a proxy, are dialed as usual.
+func pinnedDialer(dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		addrs, ok := pinnedHosts[host]
+		if !ok {
+			return dialer.DialContext(ctx, network, addr)
+		}
+		var lastErr error
+		for _, ip := range addrs {
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+		}
+		return nil, lastErr
+	}
+}
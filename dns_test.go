@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPinnedDialerUsesThePinnedAddress(t *testing.T) {
+	var hosts []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hosts = append(hosts, r.Host)
+	}))
+	defer server.Close()
+	_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resetRun(t)
+	// Only 127.0.0.1 listens on the port, the dialer moves on to it when the
+	// first address refuses the connection.
+	pinnedHosts["nexus.invalid"] = []string{"127.0.0.2", "127.0.0.1"}
+	resp, err := newHTTPClient().Get("http://nexus.invalid:" + port + "/ga/")
+	if err != nil {
+		t.Fatalf("the pinned address wasn't dialed: %v", err)
+	}
+	resp.Body.Close()
+	if len(hosts) != 1 || hosts[0] != "nexus.invalid:"+port {
+		t.Errorf("the server saw the hosts %v, want the remote name kept", hosts)
+	}
+}
+
+func TestPinDNSResolvesTheRemotesOnce(t *testing.T) {
+	resetRun(t)
+	nexusRoots = stringList{"http://localhost:8081", "http://127.0.0.1:8082", "file:///srv/mirror"}
+	if err := pinDNS(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(pinnedHosts) != 1 || len(pinnedHosts["localhost"]) == 0 {
+		t.Errorf("pinned %v, want localhost only", pinnedHosts)
+	}
+	nexusRoots = stringList{"http://nexus.invalid"}
+	if err := pinDNS(context.Background()); err == nil || !strings.Contains(err.Error(), "nexus.invalid") {
+		t.Errorf("an unresolvable remote gave %v", err)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const envPrefix = "NEXUS_CRAWLER_"
+
+// applyEnvironment sets every flag that wasn't given on the command line from
+// its environment variable, e.g. --nexus-root from NEXUS_CRAWLER_NEXUS_ROOT.
+// The precedence is: explicit flag, then environment variable, then default.
+func applyEnvironment() error {
+	explicit := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+	var err error
+	flag.VisitAll(func(f *flag.Flag) {
+		if explicit[f.Name] || err != nil {
+			return
+		}
+		key := envKey(f.Name)
+		if value, ok := os.LookupEnv(key); ok {
+			if setErr := flag.Set(f.Name, value); setErr != nil {
+				err = fmt.Errorf("invalid %v: %v", key, setErr)
+			}
+		}
+	})
+	return err
+}
+
+// envKey maps a flag name to its environment variable.
+func envKey(name string) string {
+	return envPrefix + strings.ToUpper(strings.Replace(name, "-", "_", -1))
+}
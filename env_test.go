@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestEnvironmentFillsAbsentFlags(t *testing.T) {
+	local := t.TempDir()
+	writeTree(t, local, map[string]string{"org/e/lib/1.0/lib-1.0.jar": "jar content"})
+	os.Setenv(envKey("run-id"), "from-env")
+	defer os.Unsetenv(envKey("run-id"))
+
+	_, output := runMain(t, "--maven-repository", local, "--local-only")
+	if !strings.Contains(output, "[from-env]") {
+		t.Errorf("%v wasn't picked up without --run-id:\n%v", envKey("run-id"), output)
+	}
+	_, output = runMain(t, "--maven-repository", local, "--local-only", "--run-id", "from-flag")
+	if !strings.Contains(output, "[from-flag]") || strings.Contains(output, "from-env") {
+		t.Errorf("--run-id didn't take precedence over %v:\n%v", envKey("run-id"), output)
+	}
+}
+
+func TestEnvironmentRejectsInvalidValues(t *testing.T) {
+	os.Setenv(envKey("threads"), "many")
+	defer os.Unsetenv(envKey("threads"))
+	code, output := runMain(t, "--maven-repository", t.TempDir())
+	if code != 3 || !strings.Contains(output, "invalid "+envKey("threads")) {
+		t.Errorf("exit code %v, output %q", code, output)
+	}
+}
+
+func TestEnvKey(t *testing.T) {
+	if got := envKey("nexus-root"); got != "NEXUS_CRAWLER_NEXUS_ROOT" {
+		t.Errorf("envKey(nexus-root) = %v", got)
+	}
+}
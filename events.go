@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// eventWriteTimeout bounds how long a slow reader may hold up the crawl before
+// it's disconnected.
+const eventWriteTimeout = time.Second
+
+// eventStream broadcasts NDJSON events to the processes connected to the
+// --events-socket Unix socket. No reader being connected is fine, events are
+// then simply dropped. A nil *eventStream discards everything.
+type eventStream struct {
+	path     string
+	listener net.Listener
+	mu       sync.Mutex
+	conns    []net.Conn
+	checked  int
+}
+
+// event is one NDJSON line of the stream.
+type event struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	Type          string `json:"type"`
+	RunID         string `json:"runId"`
+	Time          string `json:"time"`
+	Group         string `json:"group,omitempty"`
+	Path          string `json:"path,omitempty"`
+	Code          int    `json:"code,omitempty"`
+	Outcome       string `json:"outcome,omitempty"`
+	Checked       int    `json:"checked,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+var events *eventStream
+
+// openEventStream listens on path, replacing a stale socket left by an earlier
+// run, and removes the socket again on SIGINT/SIGTERM.
+func openEventStream(path string) (*eventStream, error) {
+	os.Remove(path)
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	s := &eventStream{path: path, listener: listener}
+	go s.accept()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		s.close()
+		os.Exit(1)
+	}()
+	return s, nil
+}
+
+func (s *eventStream) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns = append(s.conns, conn)
+		s.mu.Unlock()
+	}
+}
+
+func (s *eventStream) emit(e event) {
+	if s == nil {
+		return
+	}
+	e.SchemaVersion = schemaVersion
+	e.RunID = repo.runID
+	e.Time = formatTime(time.Now())
+	line, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("Events error: %v", err)
+		return
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	connected := s.conns[:0]
+	for _, conn := range s.conns {
+		conn.SetWriteDeadline(time.Now().Add(eventWriteTimeout))
+		if _, err := conn.Write(line); err != nil {
+			conn.Close()
+			continue
+		}
+		connected = append(connected, conn)
+	}
+	s.conns = connected
+}
+
+// result emits the outcome of a checked artifact along with the running count.
+func (s *eventStream) result(r Result, outcome string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.checked++
+	checked := s.checked
+	s.mu.Unlock()
+	s.emit(event{Type: "result", Group: r.group, Path: r.path, Code: r.code, Outcome: outcome, Checked: checked})
+}
+
+// finish emits the final event of the run, carrying err if the scan failed.
+func (s *eventStream) finish(err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	e := event{Type: "finish", Checked: s.checked}
+	s.mu.Unlock()
+	if err != nil {
+		e.Error = err.Error()
+	}
+	s.emit(e)
+}
+
+// close disconnects every reader and removes the socket.
+func (s *eventStream) close() {
+	if s == nil {
+		return
+	}
+	s.listener.Close()
+	s.mu.Lock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+	s.mu.Unlock()
+	os.Remove(s.path)
+}
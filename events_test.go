@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEventsArriveInOrder(t *testing.T) {
+	local, remote := t.TempDir(), t.TempDir()
+	mirrorTree(t, local, remote, 3)
+	server, _ := serveTree(t, remote)
+	socket := filepath.Join(t.TempDir(), "events.sock")
+	resetRun(t)
+	stream, err := openEventStream(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// No reader being connected mustn't hold anything up.
+	stream.emit(event{Type: "dropped"})
+
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		stream.mu.Lock()
+		accepted := len(stream.conns)
+		stream.mu.Unlock()
+		if accepted == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the reader was never accepted")
+		}
+	}
+
+	// As runCrawler does, but for the stream main would open.
+	defer func(args []string) { os.Args = args }(os.Args)
+	os.Args = []string{"nexus_crawler", "--maven-repository", local, "--nexus-root", server.URL, "--repository-name", ""}
+	parseFlags()
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	events = stream
+	err = scan()
+	events.finish(err)
+	events.close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(socket); !os.IsNotExist(err) {
+		t.Errorf("the socket outlived the stream: %v", err)
+	}
+
+	var received []event
+	lines := bufio.NewScanner(conn)
+	for lines.Scan() {
+		var e event
+		if err := json.Unmarshal(lines.Bytes(), &e); err != nil {
+			t.Fatalf("%q: %v", lines.Text(), err)
+		}
+		received = append(received, e)
+	}
+	if len(received) < 3 || received[0].Type != "start" || received[len(received)-1].Type != "finish" {
+		t.Fatalf("events = %+v, want start, the results and finish", received)
+	}
+	results := received[1 : len(received)-1]
+	for i, e := range results {
+		if e.Type != "result" || e.Checked != i+1 {
+			t.Errorf("event %v = %+v, want result %v", i+1, e, i+1)
+		}
+	}
+	if finish := received[len(received)-1]; finish.Checked != len(results) || finish.Checked != checkedCount() {
+		t.Errorf("finish counted %v, %v results were streamed and %v checked", finish.Checked, len(results), checkedCount())
+	}
+}
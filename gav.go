@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// GAV identifies a Maven artifact by its coordinates.
+type GAV struct {
+	groupId    string
+	artifactId string
+	version    string
+	classifier string
+	packaging  string
+}
+
+// parseGAV parses groupId:artifactId:version[:classifier[:packaging]].
+// The packaging defaults to jar.
+func parseGAV(coordinates string) (GAV, error) {
+	parts := strings.Split(coordinates, ":")
+	if len(parts) < 3 || len(parts) > 5 {
+		return GAV{}, fmt.Errorf("%q is not groupId:artifactId:version[:classifier[:packaging]]", coordinates)
+	}
+	for _, part := range parts[:3] {
+		if part == "" {
+			return GAV{}, fmt.Errorf("%q has an empty groupId, artifactId or version", coordinates)
+		}
+	}
+	g := GAV{groupId: parts[0], artifactId: parts[1], version: parts[2], packaging: "jar"}
+	if len(parts) > 3 {
+		g.classifier = parts[3]
+	}
+	if len(parts) > 4 && parts[4] != "" {
+		g.packaging = parts[4]
+	}
+	return g, nil
+}
+
+// String renders g back as coordinates, leaving out the default packaging.
+func (g GAV) String() string {
+	coordinates := g.groupId + ":" + g.artifactId + ":" + g.version
+	if g.packaging != "jar" {
+		return coordinates + ":" + g.classifier + ":" + g.packaging
+	}
+	if g.classifier != "" {
+		coordinates += ":" + g.classifier
+	}
+	return coordinates
+}
+
+// gavTargets are checked in place of the local walk: the --gav or every line
+// of --gav-file.
+var gavTargets []GAV
+
+// checkingGAVs tells whether coordinates replace the local walk.
+func checkingGAVs() bool {
+	return *gav != "" || *gavFile != ""
+}
+
+// loadGAVFile parses --gav-file, one set of coordinates per line. Blank lines
+// and # comments are skipped.
+func loadGAVFile(file string) ([]GAV, error) {
+	input, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("--gav-file %v cannot be read: %v", file, err)
+	}
+	defer input.Close()
+	var targets []GAV
+	scanner := bufio.NewScanner(input)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		g, err := parseGAV(line)
+		if err != nil {
+			return nil, fmt.Errorf("--gav-file %v line %v: %v", file, n, err)
+		}
+		targets = append(targets, g)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("--gav-file %v cannot be read: %v", file, err)
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("--gav-file %v lists no coordinates", file)
+	}
+	return targets, nil
+}
+
+// gavPaths lists the paths of every target once, a POM shared by several
+// classifiers of a version included.
+func gavPaths() []string {
+	var paths []string
+	seen := map[string]bool{}
+	for _, g := range gavTargets {
+		for _, p := range g.paths() {
+			if !seen[p] {
+				seen[p] = true
+				paths = append(paths, p)
+			}
+		}
+	}
+	return paths
+}
+
+// gavStatus maps every target to the outcome of its paths: present when all
+// of them are, otherwise the outcome of the first one that isn't, or
+// not-checked when a path never got a result.
+func gavStatus() map[string]string {
+	status := map[string]string{}
+	for _, g := range gavTargets {
+		status[g.String()] = outcomePresent
+		for _, p := range g.paths() {
+			outcome, ok := repo.gavOutcomes[p]
+			if !ok {
+				outcome = "not-checked"
+			}
+			if outcome != outcomePresent {
+				status[g.String()] = outcome
+				break
+			}
+		}
+	}
+	return status
+}
+
+// dir is the version directory of g relative to the repository root.
+func (g GAV) dir() string {
+	return path.Join(strings.Replace(g.groupId, ".", "/", -1), g.artifactId, g.version)
+}
+
+// fileName builds artifactId-version[-classifier].extension.
+func (g GAV) fileName(classifier string, extension string) string {
+	name := g.artifactId + "-" + g.version
+	if classifier != "" {
+		name += "-" + classifier
+	}
+	return name + "." + extension
+}
+
+// paths lists the repository paths expected for g: the artifact itself and its POM.
+func (g GAV) paths() []string {
+	paths := []string{path.Join(g.dir(), g.fileName(g.classifier, g.packaging))}
+	if g.classifier != "" || g.packaging != "pom" {
+		paths = append(paths, path.Join(g.dir(), g.fileName("", "pom")))
+	}
+	return paths
+}
+
+// gavFromPath derives the coordinates of a primary artifact from its repository
+// path, with the extension as packaging. Sidecars, signatures, metadata and
+// paths off the Maven layout have none.
+func gavFromPath(relPath string) (GAV, bool) {
+	relPath = filepath.ToSlash(relPath)
+	name := path.Base(relPath)
+	if isChecksumFile(name) || strings.HasSuffix(name, ".asc") || strings.HasPrefix(name, "maven-metadata") || checkLayout(relPath) != nil {
+		return GAV{}, false
+	}
+	segments := strings.Split(path.Dir(relPath), "/")
+	n := len(segments)
+	g := GAV{groupId: strings.Join(segments[:n-2], "."), artifactId: segments[n-2], version: segments[n-1]}
+	rest, _ := artifactSuffix(name, g.artifactId, g.version)
+	if strings.HasPrefix(rest, "-") {
+		dot := strings.Index(rest, ".")
+		g.classifier, rest = rest[1:dot], rest[dot:]
+	}
+	g.packaging = rest[1:]
+	return g, true
+}
+
+// classifiers holds the repeatable --classifier flag.
+var classifiers stringList
+
+// classifierSelected applies --classifier: only files of the listed
+// classifiers are checked, sidecars and signatures along with their artifact.
+// Directories, metadata and files off the Maven layout are left out.
+func classifierSelected(artifact LocalArtifact) bool {
+	if len(classifiers) == 0 {
+		return true
+	}
+	if artifact.isDir {
+		return false
+	}
+	primary := artifact.path
+	for _, ext := range append(checksumExtensions, ".asc") {
+		primary = strings.TrimSuffix(primary, ext)
+	}
+	g, ok := gavFromPath(primary)
+	if !ok {
+		return false
+	}
+	for _, classifier := range classifiers {
+		if g.classifier == classifier {
+			return true
+		}
+	}
+	return false
+}
+
+// listedArtifacts emits the given repository file paths in place of the local walk.
+func listedArtifacts(done <-chan struct{}, paths []string) (<-chan LocalArtifact, <-chan error) {
+	artifacts := make(chan LocalArtifact)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(artifacts)
+		for _, p := range paths {
+			select {
+			case artifacts <- LocalArtifact{path: p}:
+			case <-done:
+				errs <- errors.New("Scan cancelled ...")
+				return
+			}
+		}
+		errs <- nil
+	}()
+	return artifacts, errs
+}
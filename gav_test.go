@@ -0,0 +1,149 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestParseGAVPaths(t *testing.T) {
+	for _, test := range []struct {
+		coordinates string
+		want        []string
+	}{
+		{"org.e:lib:1.0", []string{"org/e/lib/1.0/lib-1.0.jar", "org/e/lib/1.0/lib-1.0.pom"}},
+		{"org.e:lib:1.0:sources", []string{"org/e/lib/1.0/lib-1.0-sources.jar", "org/e/lib/1.0/lib-1.0.pom"}},
+		{"org.e:parent:1.0::pom", []string{"org/e/parent/1.0/parent-1.0.pom"}},
+		{"org.e.deep:app:2.1-SNAPSHOT::war", []string{"org/e/deep/app/2.1-SNAPSHOT/app-2.1-SNAPSHOT.war", "org/e/deep/app/2.1-SNAPSHOT/app-2.1-SNAPSHOT.pom"}},
+	} {
+		g, err := parseGAV(test.coordinates)
+		if err != nil {
+			t.Errorf("parseGAV(%q): %v", test.coordinates, err)
+			continue
+		}
+		if got := g.paths(); strings.Join(got, ",") != strings.Join(test.want, ",") {
+			t.Errorf("paths of %q = %v, want %v", test.coordinates, got, test.want)
+		}
+		if got, err := parseGAV(g.String()); err != nil || got != g {
+			t.Errorf("%q doesn't round trip through %q", test.coordinates, g.String())
+		}
+	}
+	for _, invalid := range []string{"org.e:lib", "org.e::1.0", "a:b:c:d:e:f"} {
+		if _, err := parseGAV(invalid); err == nil {
+			t.Errorf("parseGAV(%q) accepted it", invalid)
+		}
+	}
+}
+
+func TestCheckGAV(t *testing.T) {
+	remote := t.TempDir()
+	writeTree(t, remote, map[string]string{
+		"org/e/lib/1.0/lib-1.0.jar": "jar content",
+		"org/e/lib/1.0/lib-1.0.pom": "<project/>",
+	})
+	server, _ := serveTree(t, remote)
+	if err := runCrawler(t, "--gav", "org.e:lib:1.0", "--nexus-root", server.URL, "--repository-name", ""); err != nil {
+		t.Fatal(err)
+	}
+	if status := gavStatus(); status["org.e:lib:1.0"] != outcomePresent {
+		t.Errorf("gav status = %v", status)
+	}
+	if len(repo.lostFiles) != 0 || checkedCount() != 2 {
+		t.Errorf("checked %v, lost %v, want the jar and POM present", checkedCount(), repo.lostFiles)
+	}
+}
+
+func TestClassifierFilter(t *testing.T) {
+	local := t.TempDir()
+	writeTree(t, local, map[string]string{
+		"org/e/lib/1.0/lib-1.0.jar":              "jar content",
+		"org/e/lib/1.0/lib-1.0.pom":              "<project/>",
+		"org/e/lib/1.0/lib-1.0-sources.jar":      "sources",
+		"org/e/lib/1.0/lib-1.0-sources.jar.sha1": sha1Hex("sources"),
+		"org/e/lib/1.0/lib-1.0-javadoc.jar":      "javadoc",
+		"org/e/app/2.0/app-2.0-sources.jar":      "sources",
+	})
+	server, _ := serveTree(t, t.TempDir())
+	args := []string{"--maven-repository", local, "--nexus-root", server.URL, "--repository-name", ""}
+	for _, test := range []struct {
+		classifiers []string
+		want        []string
+	}{
+		{[]string{"sources"}, []string{"org/e/app/2.0/app-2.0-sources.jar", "org/e/lib/1.0/lib-1.0-sources.jar", "org/e/lib/1.0/lib-1.0-sources.jar.sha1"}},
+		{[]string{""}, []string{"org/e/lib/1.0/lib-1.0.jar", "org/e/lib/1.0/lib-1.0.pom"}},
+		{[]string{"javadoc", ""}, []string{"org/e/lib/1.0/lib-1.0-javadoc.jar", "org/e/lib/1.0/lib-1.0.jar", "org/e/lib/1.0/lib-1.0.pom"}},
+	} {
+		withClassifiers := args
+		for _, classifier := range test.classifiers {
+			withClassifiers = append(withClassifiers, "--classifier", classifier)
+		}
+		if err := runCrawler(t, withClassifiers...); err != nil {
+			t.Fatal(err)
+		}
+		// Nothing is on the remote, so everything checked is lost, and the
+		// directories aren't checked at all.
+		var got []string
+		for _, lost := range repo.lostFiles {
+			got = append(got, strings.TrimPrefix(lost, server.URL+"/"))
+		}
+		sort.Strings(got)
+		if strings.Join(got, " ") != strings.Join(test.want, " ") || len(repo.lostDirs) != 0 {
+			t.Errorf("--classifier %q checked %v and %v, want %v", test.classifiers, repo.lostDirs, got, test.want)
+		}
+	}
+}
+
+func TestCheckGAVFile(t *testing.T) {
+	remote, out := t.TempDir(), t.TempDir()
+	writeTree(t, remote, map[string]string{
+		"org/e/lib/1.0/lib-1.0.jar":         "jar content",
+		"org/e/lib/1.0/lib-1.0-sources.jar": "sources",
+		"org/e/lib/1.0/lib-1.0.pom":         "<project/>",
+		"org/e/bom/2.0/bom-2.0.pom":         "<project/>",
+		"org/e/app/3.0/app-3.0.pom":         "<project/>",
+	})
+	server, _ := serveTree(t, remote)
+	file := filepath.Join(out, "release.txt")
+	writeTree(t, out, map[string]string{"release.txt": `# release 1
+org.e:lib:1.0
+org.e:lib:1.0:sources:jar
+
+org.e:bom:2.0::pom
+org.e:app:3.0
+org.e:lib:1.0:javadoc:jar
+`})
+	if err := runCrawler(t, "--gav-file", file, "--nexus-root", server.URL, "--repository-name", ""); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"org.e:lib:1.0":         outcomePresent,
+		"org.e:lib:1.0:sources": outcomePresent,
+		"org.e:bom:2.0::pom":    outcomePresent,
+		// The POM is there, the jar isn't.
+		"org.e:app:3.0":         outcomeLost,
+		"org.e:lib:1.0:javadoc": outcomeLost,
+	}
+	if status := gavStatus(); !reflect.DeepEqual(status, want) {
+		t.Errorf("gav status = %v, want %v", status, want)
+	}
+	// The POM of org.e:lib:1.0 is checked once for its three coordinates.
+	if checkedCount() != 7 || len(repo.lostFiles) != 2 {
+		t.Errorf("checked %v, lost %v", checkedCount(), repo.lostFiles)
+	}
+}
+
+func TestLoadGAVFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"bad.txt":   "org.e:lib:1.0\n\norg.e:lib\n",
+		"empty.txt": "# nothing yet\n\n",
+	})
+	if _, err := loadGAVFile(filepath.Join(dir, "bad.txt")); err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("bad coordinates: %v, want line 3 named", err)
+	}
+	if _, err := loadGAVFile(filepath.Join(dir, "empty.txt")); err == nil || !strings.Contains(err.Error(), "lists no coordinates") {
+		t.Errorf("no coordinates: %v", err)
+	}
+}
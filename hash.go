@@ -0,0 +1,161 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+const hashBufferSize = 32 * 1024
+
+var hashBuffers = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, hashBufferSize)
+		return &buf
+	},
+}
+
+// hashers holds a digest per algorithm, Reset and reused between files.
+type hashers struct {
+	md5    hash.Hash
+	sha1   hash.Hash
+	sha256 hash.Hash
+	sha512 hash.Hash
+}
+
+var hasherPool = sync.Pool{
+	New: func() interface{} {
+		return &hashers{md5.New(), sha1.New(), sha256.New(), sha512.New()}
+	},
+}
+
+// digests selects the digests hashFile computes.
+type digests struct {
+	md5    bool
+	sha1   bool
+	sha256 bool
+	sha512 bool
+}
+
+func (d digests) none() bool {
+	return !d.md5 && !d.sha1 && !d.sha256 && !d.sha512
+}
+
+// checksums are the hex digests computed for a file, empty when not wanted.
+type checksums struct {
+	md5    string
+	sha1   string
+	sha256 string
+	sha512 string
+}
+
+// checksumAlgorithms holds the --checksum selection besides md5 and sha1,
+// which set --md5Sum and --sha1Sum.
+var checksumAlgorithms = map[string]bool{}
+
+// parseChecksums reads --checksum.
+func parseChecksums(value string) error {
+	for _, algorithm := range strings.Split(value, ",") {
+		switch algorithm = strings.ToLower(strings.TrimSpace(algorithm)); algorithm {
+		case "":
+		case "md5":
+			*md5Sum = true
+		case "sha1":
+			*sha1Sum = true
+		case "sha256", "sha512":
+			checksumAlgorithms[algorithm] = true
+		default:
+			return fmt.Errorf("--checksum: unknown algorithm %v, expected md5, sha1, sha256 or sha512", algorithm)
+		}
+	}
+	return nil
+}
+
+// neededDigests returns the digests some check or report of this run uses:
+// the remote checksum and ETag verification, the local sidecar checks, the
+// dedupe report, the inventory and the trusted manifest.
+func neededDigests() digests {
+	return digests{
+		md5:    *md5Sum || *etagAsMD5 || *localOnly || *checkLocalChecksums || *localChecks || *artifactInventory != "" || manifestDigests.md5,
+		sha1:   *sha1Sum || *localOnly || *checkLocalChecksums || *localChecks || *artifactInventory != "" || *dedupeIdenticalFiles != "" || manifestDigests.sha1,
+		sha256: checksumAlgorithms["sha256"],
+		sha512: checksumAlgorithms["sha512"],
+	}
+}
+
+// wantedFor narrows want for the file at path. The .md5/.sha1 sidecars and
+// .asc signatures aren't hashed themselves, they are tiny but numerous and
+// nothing checks their digests, unless --artifact-inventory lists them or
+// --trusted-manifest may trust them.
+func wantedFor(path string, want digests) digests {
+	if (isChecksumFile(path) || strings.HasSuffix(path, ".asc")) && *artifactInventory == "" && len(trustedFiles) == 0 {
+		return digests{}
+	}
+	return want
+}
+
+// hashFile streams the file at path through the wanted digests using pooled
+// buffers and hashers, so large trees don't allocate per file. The file isn't
+// read at all when no digest is wanted. Pooled objects are returned on every
+// path, including errors.
+func hashFile(path string, want digests) (checksums, error) {
+	if want.none() {
+		return checksums{}, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return checksums{}, err
+	}
+	defer file.Close()
+	// Hide os.File's WriterTo so the pooled buffer is actually used.
+	return hashReader(struct{ io.Reader }{file}, want)
+}
+
+// hashReader streams r through the wanted digests like hashFile, for content
+// that isn't a plain file such as an archive entry. The selected digests are
+// all fed by one io.MultiWriter, so the content is read once.
+func hashReader(r io.Reader, want digests) (checksums, error) {
+	if want.none() {
+		return checksums{}, nil
+	}
+	buf := hashBuffers.Get().(*[]byte)
+	defer hashBuffers.Put(buf)
+	h := hasherPool.Get().(*hashers)
+	defer hasherPool.Put(h)
+	var sums checksums
+	selected := []struct {
+		wanted bool
+		h      hash.Hash
+		sum    *string
+	}{
+		{want.md5, h.md5, &sums.md5},
+		{want.sha1, h.sha1, &sums.sha1},
+		{want.sha256, h.sha256, &sums.sha256},
+		{want.sha512, h.sha512, &sums.sha512},
+	}
+	var writers []io.Writer
+	for _, s := range selected {
+		if s.wanted {
+			s.h.Reset()
+			writers = append(writers, s.h)
+		}
+	}
+
+	if _, err := io.CopyBuffer(io.MultiWriter(writers...), r, *buf); err != nil {
+		return checksums{}, err
+	}
+	for _, s := range selected {
+		if s.wanted {
+			*s.sum = hex.EncodeToString(s.h.Sum(nil))
+		}
+	}
+	return sums, nil
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHashFileComputesDigests(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "lib-1.0.jar")
+	content := strings.Repeat("jar content ", 10000)
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sums, err := hashFile(file, digests{md5: true, sha1: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sums.md5 != md5Hex(content) || sums.sha1 != sha1Hex(content) {
+		t.Errorf("hashFile = %v/%v, want %v/%v", sums.md5, sums.sha1, md5Hex(content), sha1Hex(content))
+	}
+}
+
+// failingReader fails after handing out its content.
+type failingReader struct {
+	r io.Reader
+}
+
+func (f failingReader) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	if err == io.EOF {
+		return n, errors.New("read failed")
+	}
+	return n, err
+}
+
+func TestHashReaderErrorLeavesPoolsUsable(t *testing.T) {
+	want := digests{md5: true, sha1: true}
+	for i := 0; i < 10; i++ {
+		if _, err := hashReader(failingReader{strings.NewReader("partial")}, want); err == nil {
+			t.Fatal("hashReader ignored the read error")
+		}
+	}
+	// A hasher put back half fed must be reset before it is used again.
+	sums, err := hashReader(strings.NewReader("content"), want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sums.md5 != md5Hex("content") || sums.sha1 != sha1Hex("content") {
+		t.Errorf("hashReader after errors = %v/%v, want %v/%v", sums.md5, sums.sha1, md5Hex("content"), sha1Hex("content"))
+	}
+}
+
+// benchmarkFile writes a file of size bytes to hash.
+func benchmarkFile(b *testing.B, size int) string {
+	b.Helper()
+	file := filepath.Join(b.TempDir(), "lib-1.0.jar")
+	if err := os.WriteFile(file, []byte(strings.Repeat("x", size)), 0644); err != nil {
+		b.Fatal(err)
+	}
+	return file
+}
+
+// hashFileUnpooled hashes the way scanLocalPath did before the pools, with
+// fresh hashers and an io.Copy buffer per file.
+func hashFileUnpooled(path string) (checksums, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return checksums{}, err
+	}
+	defer file.Close()
+	m, s := md5.New(), sha1.New()
+	if _, err := io.Copy(io.MultiWriter(m, s), struct{ io.Reader }{file}); err != nil {
+		return checksums{}, err
+	}
+	return checksums{md5: hex.EncodeToString(m.Sum(nil)), sha1: hex.EncodeToString(s.Sum(nil))}, nil
+}
+
+// BenchmarkHashFile compares the pooled hashing with allocating per file, run
+// it with -benchmem to see the allocations saved.
+func BenchmarkHashFile(b *testing.B) {
+	file := benchmarkFile(b, 64*1024)
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(64 * 1024)
+		for i := 0; i < b.N; i++ {
+			if _, err := hashFile(file, digests{md5: true, sha1: true}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("unpooled", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(64 * 1024)
+		for i := 0; i < b.N; i++ {
+			if _, err := hashFileUnpooled(file); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestHashFileComputesOnlyWantedDigests(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "lib-1.0.jar")
+	if err := os.WriteFile(file, []byte("jar content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sums, err := hashFile(file, digests{md5: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sums.md5 != md5Hex("jar content") || sums.sha1 != "" || sums.sha256 != "" || sums.sha512 != "" {
+		t.Errorf("md5 only hashFile = %+v", sums)
+	}
+	sums, err = hashFile(file, digests{sha1: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sums.md5 != "" || sums.sha1 != sha1Hex("jar content") {
+		t.Errorf("sha1 only hashFile = %+v", sums)
+	}
+	// Without any digest the file isn't even opened.
+	if _, err := hashFile(filepath.Join(t.TempDir(), "absent.jar"), digests{}); err != nil {
+		t.Errorf("hashFile without digests read the file: %v", err)
+	}
+}
+
+func TestNeededDigestsFollowFlags(t *testing.T) {
+	resetRun(t)
+	if want := neededDigests(); !want.none() {
+		t.Errorf("plain existence check wants %+v", want)
+	}
+	*md5Sum = true
+	if want := neededDigests(); !want.md5 || want.sha1 {
+		t.Errorf("--md5Sum wants %+v", want)
+	}
+	*md5Sum, *checkLocalChecksums = false, true
+	if want := neededDigests(); !want.md5 || !want.sha1 {
+		t.Errorf("--check-local-checksums wants %+v", want)
+	}
+}
+
+// BenchmarkHashFileDigests compares hashing md5 alone with md5 and sha1.
+func BenchmarkHashFileDigests(b *testing.B) {
+	file := benchmarkFile(b, 1024*1024)
+	for _, bench := range []struct {
+		name string
+		want digests
+	}{
+		{"md5", digests{md5: true}},
+		{"md5+sha1", digests{md5: true, sha1: true}},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			b.SetBytes(1024 * 1024)
+			for i := 0; i < b.N; i++ {
+				if _, err := hashFile(file, bench.want); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestSidecarsAreNotHashed(t *testing.T) {
+	resetRun(t)
+	*md5Sum = true
+	local := t.TempDir()
+	writeTree(t, local, map[string]string{
+		"org/e/lib/1.0/lib-1.0.jar":      "jar content",
+		"org/e/lib/1.0/lib-1.0.jar.md5":  md5Hex("jar content"),
+		"org/e/lib/1.0/lib-1.0.jar.sha1": sha1Hex("jar content"),
+		"org/e/lib/1.0/lib-1.0.jar.asc":  "signature",
+	})
+	done := make(chan struct{})
+	defer close(done)
+	artifacts, errs := scanLocalPath(done, local, "")
+	hashed := map[string]string{}
+	for a := range artifacts {
+		if !a.isDir {
+			hashed[filepath.ToSlash(a.path)] = a.md5
+		}
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	if hashed["org/e/lib/1.0/lib-1.0.jar"] != md5Hex("jar content") {
+		t.Errorf("the jar was hashed to %q", hashed["org/e/lib/1.0/lib-1.0.jar"])
+	}
+	for _, sidecar := range []string{".md5", ".sha1", ".asc"} {
+		if sum, ok := hashed["org/e/lib/1.0/lib-1.0.jar"+sidecar]; !ok || sum != "" {
+			t.Errorf("%v sidecar walked %v, hashed to %q", sidecar, ok, sum)
+		}
+	}
+	// An inventory lists the digests of every file.
+	*artifactInventory = "inventory.json"
+	if want := wantedFor("lib-1.0.jar.md5", digests{md5: true}); !want.md5 {
+		t.Error("sidecars aren't hashed for --artifact-inventory")
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"sort"
+	"sync"
+)
+
+// contentIndex maps the sha1 of every local file to the paths holding that
+// content. Every repository group walks the tree again, so paths are kept as a
+// set to stay idempotent.
+type contentIndex struct {
+	mu    sync.Mutex
+	paths map[string]map[string]bool
+	sizes map[string]int64
+}
+
+var identicalFiles = contentIndex{paths: map[string]map[string]bool{}, sizes: map[string]int64{}}
+
+// identicalGroup is a set of local files with the same content.
+type identicalGroup struct {
+	Sha1  string   `json:"sha1"`
+	Size  int64    `json:"size"`
+	Paths []string `json:"paths"`
+}
+
+// identicalReport is the layout of the --dedupe-identical-files report.
+type identicalReport struct {
+	SchemaVersion int              `json:"schemaVersion"`
+	RunID         string           `json:"runId"`
+	Groups        []identicalGroup `json:"groups"`
+}
+
+// add indexes a hashed local file. Empty files are reported as zero-byte
+// instead, and checksum files only ever duplicate their primary artifact.
+func (c *contentIndex) add(artifact LocalArtifact) {
+	if artifact.sha1 == "" || artifact.size == 0 || isChecksumFile(artifact.path) {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.paths[artifact.sha1] == nil {
+		c.paths[artifact.sha1] = map[string]bool{}
+	}
+	c.paths[artifact.sha1][artifact.where()] = true
+	c.sizes[artifact.sha1] = artifact.size
+}
+
+// groups returns the content held by more than one path, largest files first.
+func (c *contentIndex) groups() []identicalGroup {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	groups := []identicalGroup{}
+	for sha1, paths := range c.paths {
+		if len(paths) > 1 {
+			groups = append(groups, identicalGroup{sha1, c.sizes[sha1], sortedKeys(paths)})
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Size != groups[j].Size {
+			return groups[i].Size > groups[j].Size
+		}
+		return groups[i].Sha1 < groups[j].Sha1
+	})
+	return groups
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDedupeIdenticalFiles(t *testing.T) {
+	local := t.TempDir()
+	writeTree(t, local, map[string]string{
+		"org/e/lib/1.0/lib-1.0.jar":           "jar content",
+		"org/e/lib/1.0/lib-1.0.jar.sha1":      sha1Hex("jar content"),
+		"com/mirror/lib/1.0/lib-1.0.jar":      "jar content",
+		"com/mirror/lib/1.0/lib-1.0.jar.sha1": sha1Hex("jar content"),
+		"org/e/lib/1.0/lib-1.0.pom":           "<project><artifactId>lib</artifactId></project>",
+		"org/e/lib/2.0/empty.txt":             "",
+		"org/e/lib/2.0/also-empty.txt":        "",
+	})
+	report := filepath.Join(t.TempDir(), "identical.json")
+	if err := runCrawler(t, "--maven-repository", local, "--local-only", "--dedupe-identical-files", report); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeReports(); err != nil {
+		t.Fatal(err)
+	}
+	var identical identicalReport
+	readJSON(t, report, &identical)
+	// The sidecars only duplicate their jars and the empty files carry no content.
+	want := []identicalGroup{{
+		Sha1:  sha1Hex("jar content"),
+		Size:  int64(len("jar content")),
+		Paths: []string{filepath.FromSlash("com/mirror/lib/1.0/lib-1.0.jar"), filepath.FromSlash("org/e/lib/1.0/lib-1.0.jar")},
+	}}
+	if !reflect.DeepEqual(identical.Groups, want) || identical.RunID != repo.runID {
+		t.Errorf("identical files = %+v, want %+v", identical, want)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"sort"
+)
+
+// inventoryReport is the layout of the --artifact-inventory file.
+type inventoryReport struct {
+	SchemaVersion int              `json:"schemaVersion"`
+	RunID         string           `json:"runId"`
+	Artifacts     []inventoryEntry `json:"artifacts"`
+}
+
+// inventoryEntry is an artifact the remote was verified to serve.
+type inventoryEntry struct {
+	GroupID    string `json:"groupId"`
+	ArtifactID string `json:"artifactId"`
+	Version    string `json:"version"`
+	Classifier string `json:"classifier,omitempty"`
+	Type       string `json:"type"`
+	MD5        string `json:"md5,omitempty"`
+	SHA1       string `json:"sha1,omitempty"`
+	Size       int64  `json:"size"`
+	URL        string `json:"url"`
+}
+
+// inventory lists the healthy files answered 200 that map to Maven
+// coordinates, ordered by URL. Forbidden files accepted with --forbidden-is-ok
+// aren't actually served and are left out.
+func inventory() []inventoryEntry {
+	entries := []inventoryEntry{}
+	for _, r := range repo.healthy {
+		if r.isDir || r.code != fileAcceptable {
+			continue
+		}
+		g, ok := gavFromPath(r.relPath)
+		if !ok {
+			continue
+		}
+		entries = append(entries, inventoryEntry{g.groupId, g.artifactId, g.version, g.classifier, g.packaging, r.md5, r.sha1, r.size, r.path})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].URL < entries[j].URL })
+	return entries
+}
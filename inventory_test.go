@@ -0,0 +1,43 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestArtifactInventoryListsServedCoordinates(t *testing.T) {
+	local, remote := t.TempDir(), t.TempDir()
+	files := map[string]string{
+		"org/e/lib/1.0/lib-1.0.jar":         "jar content",
+		"org/e/lib/1.0/lib-1.0.jar.sha1":    sha1Hex("jar content"),
+		"org/e/lib/1.0/lib-1.0-sources.jar": "sources",
+		"org/e/lib/1.0/lib-1.0.pom":         "<project/>",
+		"org/e/lib/maven-metadata.xml":      libMetadata,
+	}
+	writeTree(t, local, files)
+	writeTree(t, remote, files)
+	writeTree(t, local, map[string]string{"org/e/lib/2.0/lib-2.0.jar": "lost"})
+	server, _ := serveTree(t, remote)
+	report := filepath.Join(t.TempDir(), "inventory.json")
+	if err := runCrawler(t, "--maven-repository", local, "--nexus-root", server.URL, "--repository-name", "",
+		"--artifact-inventory", report); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeReports(); err != nil {
+		t.Fatal(err)
+	}
+	var inventory inventoryReport
+	readJSON(t, report, &inventory)
+	// Neither the sidecar, the metadata nor the lost 2.0 jar are coordinates
+	// the remote serves.
+	base := server.URL + "/org/e/lib/1.0/"
+	want := []inventoryEntry{
+		{"org.e", "lib", "1.0", "sources", "jar", md5Hex("sources"), sha1Hex("sources"), 7, base + "lib-1.0-sources.jar"},
+		{"org.e", "lib", "1.0", "", "jar", md5Hex("jar content"), sha1Hex("jar content"), 11, base + "lib-1.0.jar"},
+		{"org.e", "lib", "1.0", "", "pom", md5Hex("<project/>"), sha1Hex("<project/>"), 10, base + "lib-1.0.pom"},
+	}
+	if !reflect.DeepEqual(inventory.Artifacts, want) {
+		t.Errorf("inventory = %+v, want %+v", inventory.Artifacts, want)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// snapshotTimestamp is the timestamp and build number a deployed SNAPSHOT file
+// carries instead of -SNAPSHOT, e.g. 20240101.120000-3.
+var snapshotTimestamp = regexp.MustCompile(`^\d{8}\.\d{6}-\d+`)
+
+// checkLayout reports why relPath doesn't fit the Maven layout
+// group/as/dirs/artifactId/version/artifactId-version[-classifier].ext, or
+// returns nil when it does. Metadata files are accepted at any level, they
+// live next to the groups, artifacts and SNAPSHOT versions they describe.
+func checkLayout(relPath string) error {
+	relPath = filepath.ToSlash(relPath)
+	name := path.Base(relPath)
+	for _, ext := range append(checksumExtensions, ".asc") {
+		name = strings.TrimSuffix(name, ext)
+	}
+	if strings.HasPrefix(name, "maven-metadata") && strings.HasSuffix(name, ".xml") {
+		return nil
+	}
+	segments := strings.Split(path.Dir(relPath), "/")
+	if len(segments) < 3 || segments[0] == "." {
+		return fmt.Errorf("file is outside any groupId/artifactId/version directory")
+	}
+	version := segments[len(segments)-1]
+	artifactID := segments[len(segments)-2]
+	rest, err := artifactSuffix(name, artifactID, version)
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(rest, "-") && strings.Contains(rest, ".") && !strings.HasPrefix(rest, "-.") {
+		return nil
+	}
+	if strings.HasPrefix(rest, ".") && len(rest) > 1 {
+		return nil
+	}
+	return fmt.Errorf("file name doesn't end in [-classifier].extension after the version %v", version)
+}
+
+// artifactSuffix strips artifactId-version, or the timestamped form of a
+// SNAPSHOT version, from the start of name and returns the rest, i.e.
+// [-classifier].ext.
+func artifactSuffix(name string, artifactID string, version string) (string, error) {
+	prefix := artifactID + "-"
+	if !strings.HasPrefix(name, prefix) {
+		return "", fmt.Errorf("file name doesn't start with the artifactId %v of its directory", artifactID)
+	}
+	rest := strings.TrimPrefix(name, prefix)
+	if strings.HasPrefix(rest, version) {
+		return strings.TrimPrefix(rest, version), nil
+	}
+	base := strings.TrimSuffix(version, "SNAPSHOT")
+	if strings.HasSuffix(version, "-SNAPSHOT") && strings.HasPrefix(rest, base) {
+		stamped := strings.TrimPrefix(rest, base)
+		if timestamp := snapshotTimestamp.FindString(stamped); timestamp != "" {
+			return strings.TrimPrefix(stamped, timestamp), nil
+		}
+	}
+	return "", fmt.Errorf("file name doesn't carry the version %v of its directory", version)
+}
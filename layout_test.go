@@ -0,0 +1,51 @@
+package main
+
+import "testing"
+
+func TestCheckLayout(t *testing.T) {
+	for _, relPath := range []string{
+		"org/e/lib/1.0/lib-1.0.jar",
+		"org/e/lib/1.0/lib-1.0-sources.jar",
+		"org/e/lib/1.0/lib-1.0.tar.gz",
+		"org/e/lib/1.0/lib-1.0.jar.sha1",
+		"org/e/lib/1.0/lib-1.0.pom.asc",
+		"org/e/lib/1.0-SNAPSHOT/lib-1.0-SNAPSHOT.jar",
+		"org/e/lib/1.0-SNAPSHOT/lib-1.0-20240101.120000-3.jar",
+		"org/e/lib/1.0-SNAPSHOT/lib-1.0-20240101.120000-3-tests.jar",
+		"org/e/lib/maven-metadata.xml",
+		"org/e/lib/maven-metadata-central.xml.sha1",
+	} {
+		if err := checkLayout(relPath); err != nil {
+			t.Errorf("checkLayout(%q) = %v", relPath, err)
+		}
+	}
+	for _, relPath := range []string{
+		"README.md",
+		"org/e/lib-1.0.jar",
+		"org/e/lib/1.0/other-1.0.jar",
+		"org/e/lib/1.0/lib-2.0.jar",
+		"org/e/lib/2.0/lib-1.0.jar",
+		"org/e/lib/1.0/lib-1.0",
+		"org/e/lib/1.0/lib-1.0-.jar",
+		"org/e/lib/1.0-SNAPSHOT/lib-1.0-latest.jar",
+	} {
+		if err := checkLayout(relPath); err == nil {
+			t.Errorf("checkLayout(%q) accepted a misplaced file", relPath)
+		}
+	}
+}
+
+func TestLocalChecksReportNonCanonicalPaths(t *testing.T) {
+	local := t.TempDir()
+	writeTree(t, local, map[string]string{
+		"org/e/lib/1.0/lib-1.0.jar": "jar content",
+		// A jar of 2.0 dropped into the directory of 1.0.
+		"org/e/lib/1.0/lib-2.0.jar": "jar content",
+	})
+	if err := runCrawler(t, "--maven-repository", local, "--local-only"); err != nil {
+		t.Fatal(err)
+	}
+	if got := findingPaths(categoryNonCanonicalPath); len(got) != 1 || got[0] != "org/e/lib/1.0/lib-2.0.jar" {
+		t.Errorf("non-canonical-path findings = %v", got)
+	}
+}
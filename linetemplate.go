@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// lineFields are the fields a --line-template can use, one line per result.
+type lineFields struct {
+	// Path is the remote URL checked, RelPath the path in the local tree.
+	Path    string
+	RelPath string
+	Group   string
+	Code    int
+	Status  string
+	// Outcome is present, lost, forbidden, wrong-content or a finding category.
+	Outcome string
+	IsDir   bool
+	Size    int64
+	MD5     string
+	SHA1    string
+	// Seconds is the time the check took.
+	Seconds float64
+	// Mirror is the fallback --nexus-root that served the artifact, if any.
+	Mirror   string
+	Findings []string
+}
+
+// templateReporter writes every result to stdout through --line-template.
+// The output is buffered and flushed every --flush-interval, so the lines
+// written up to then survive the process being killed.
+type templateReporter struct {
+	mu   sync.Mutex
+	tmpl *template.Template
+	out  *bufio.Writer
+}
+
+// newTemplateReporter parses --line-template, a newline is appended to every
+// line unless the template ends with one.
+func newTemplateReporter(text string) (*templateReporter, error) {
+	if len(text) == 0 || text[len(text)-1] != '\n' {
+		text += "\n"
+	}
+	tmpl, err := template.New("line").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid --line-template: %v", err)
+	}
+	// Catch references to unknown fields up front rather than on the first result.
+	if err := tmpl.Execute(io.Discard, lineFields{}); err != nil {
+		return nil, fmt.Errorf("Invalid --line-template: %v", err)
+	}
+	t := &templateReporter{tmpl: tmpl, out: bufio.NewWriter(os.Stdout)}
+	if *flushInterval > 0 {
+		go func() {
+			for range time.Tick(*flushInterval) {
+				t.flush()
+			}
+		}()
+	}
+	return t, nil
+}
+
+var lines *templateReporter
+
+func (t *templateReporter) result(r Result, outcome string) {
+	fields := lineFields{r.path, r.relPath, r.group, r.code, r.status, outcome, r.isDir, r.size, r.md5, r.sha1, r.elapsed.Seconds(), r.mirror, nil}
+	for _, f := range r.findings {
+		fields.Findings = append(fields.Findings, f.category)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.tmpl.Execute(t.out, fields); err != nil {
+		log.Printf("Cannot write line for %v: %v", r.path, err)
+	}
+	if *flushInterval <= 0 {
+		t.out.Flush()
+	}
+}
+
+// flush writes out the buffered lines, periodically and once the run is over.
+func (t *templateReporter) flush() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.out.Flush(); err != nil {
+		log.Printf("Cannot write --line-template output: %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLineTemplateFormatsEveryResult(t *testing.T) {
+	local, remote := t.TempDir(), t.TempDir()
+	writeTree(t, local, map[string]string{
+		"org/e/lib/1.0/lib-1.0.jar": "jar content",
+		"org/e/lib/1.0/lib-1.0.pom": "<project/>",
+	})
+	writeTree(t, remote, map[string]string{"org/e/lib/1.0/lib-1.0.jar": "jar content"})
+	server, _ := serveTree(t, remote)
+	_, output := runMain(t, "--maven-repository", local, "--nexus-root", server.URL, "--repository-name", "",
+		"--dir-check", "none", "--line-template", "LINE {{.Code}} {{.RelPath}} {{.Outcome}}")
+	var got []string
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, "LINE ") {
+			got = append(got, line)
+		}
+	}
+	sort.Strings(got)
+	want := []string{
+		"LINE 200 org/e/lib/1.0/lib-1.0.jar present",
+		"LINE 404 org/e/lib/1.0/lib-1.0.pom lost",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("template lines = %q, want %q", got, want)
+	}
+}
+
+func TestLineTemplateIsValidatedAtStartup(t *testing.T) {
+	local := t.TempDir()
+	writeTree(t, local, map[string]string{"org/e/lib/1.0/lib-1.0.jar": "jar content"})
+	for _, text := range []string{"{{.Code", "{{.Nope}}"} {
+		code, output := runMain(t, "--maven-repository", local, "--line-template", text)
+		if code != 3 || !strings.Contains(output, "Invalid --line-template") {
+			t.Errorf("--line-template %q: exit code %v, output %q", text, code, output)
+		}
+	}
+}
+
+func TestFlushedLinesSurviveAKill(t *testing.T) {
+	local := t.TempDir()
+	writeTree(t, local, archiveFixture)
+	files := http.FileServer(http.Dir(local))
+	hung, release := make(chan struct{}), make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".pom") {
+			close(hung)
+			<-release
+			return
+		}
+		files.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	defer close(release)
+
+	stdout := filepath.Join(t.TempDir(), "stdout")
+	out, err := os.Create(stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestMainProcess$", "--", "--maven-repository", local, "--nexus-root", server.URL,
+		"--repository-name", "", "--no-preflight", "--dir-check", "none", "--threads", "1",
+		"--line-template", "LINE {{.RelPath}} {{.Outcome}}", "--flush-interval", "50ms")
+	cmd.Env = append(os.Environ(), "CRAWLER_TEST_MAIN=1")
+	cmd.Stdout = out
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	// The jar is checked before the pom, whose request never gets an answer.
+	select {
+	case <-hung:
+	case <-time.After(10 * time.Second):
+		cmd.Process.Kill()
+		t.Fatal("the pom was never requested")
+	}
+	time.Sleep(300 * time.Millisecond)
+	cmd.Process.Kill()
+	cmd.Wait()
+	content, err := os.ReadFile(stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "LINE org/e/lib/1.0/lib-1.0.jar present\n") {
+		t.Errorf("output before the kill: %q", content)
+	}
+}
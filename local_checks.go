@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// pomProject holds the few POM elements needed to decide whether a POM is usable.
+type pomProject struct {
+	XMLName    xml.Name `xml:"project"`
+	GroupId    string   `xml:"groupId"`
+	ArtifactId string   `xml:"artifactId"`
+	Version    string   `xml:"version"`
+	Parent     struct {
+		GroupId string `xml:"groupId"`
+		Version string `xml:"version"`
+	} `xml:"parent"`
+}
+
+// checkLocalArtifact runs the network-free checks against a walked file:
+// zero-byte detection, self-consistency with its .md5/.sha1 sidecars, sidecars
+// orphaned from their artifact, POM validity and conformance to the Maven layout.
+func checkLocalArtifact(artifact LocalArtifact) {
+	if isDownloadMarker(artifact) {
+		repo.addFinding(categoryDownloadMarker, artifact.where(), "leftover of an interrupted download")
+		return
+	}
+	if err := checkLayout(artifact.path); err != nil {
+		repo.addFinding(categoryNonCanonicalPath, artifact.where(), err.Error())
+	}
+	if artifact.size == 0 {
+		repo.addFinding(categoryZeroByte, artifact.where(), "file is empty")
+	}
+	if !isChecksumFile(artifact.path) {
+		checkLocalSidecars(artifact)
+	} else {
+		primary := strings.TrimSuffix(artifact.path, filepath.Ext(artifact.path))
+		if _, err := os.Stat(filepath.Join(artifact.root, primary)); os.IsNotExist(err) {
+			repo.addFinding(categoryOrphanChecksum, artifact.where(), "checksum file without its artifact "+filepath.Base(primary))
+		}
+	}
+	if strings.HasSuffix(artifact.path, ".pom") {
+		if err := validatePom(filepath.Join(artifact.root, artifact.path)); err != nil {
+			repo.addFinding(categoryInvalidPom, artifact.where(), err.Error())
+		}
+	}
+}
+
+// isDownloadMarker tells whether the file name matches --download-markers.
+func isDownloadMarker(artifact LocalArtifact) bool {
+	if artifact.isDir || *downloadMarkers == "" {
+		return false
+	}
+	name := filepath.Base(artifact.path)
+	for _, pattern := range strings.Split(*downloadMarkers, ",") {
+		if matched, _ := filepath.Match(strings.TrimSpace(pattern), name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// checksumExtensions are the sidecar extensions of the supported checksums.
+var checksumExtensions = []string{".md5", ".sha1", ".sha256", ".sha512"}
+
+func isChecksumFile(path string) bool {
+	for _, ext := range checksumExtensions {
+		if strings.HasSuffix(path, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkLocalSidecars compares the artifact with every local sidecar of a
+// checksum that was computed.
+func checkLocalSidecars(artifact LocalArtifact) {
+	for _, sidecar := range []struct{ ext, computed string }{
+		{".md5", artifact.md5},
+		{".sha1", artifact.sha1},
+		{".sha256", artifact.sha256},
+		{".sha512", artifact.sha512},
+	} {
+		if sidecar.computed != "" {
+			checkLocalSidecar(artifact, sidecar.ext, sidecar.computed)
+		}
+	}
+}
+
+func checkLocalSidecar(artifact LocalArtifact, ext string, computed string) {
+	sidecar := filepath.Join(artifact.root, artifact.path+ext)
+	content, err := ioutil.ReadFile(sidecar)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			repo.addFinding(categoryLocalChecksum, artifact.where()+ext, err.Error())
+		}
+		return
+	}
+	expected := normalizeChecksum(string(content))
+	if !checksumsEqual(expected, computed) {
+		repo.addFinding(categoryLocalChecksum, artifact.where(),
+			fmt.Sprintf("local %v is %v, computed %v", ext, expected, computed))
+	}
+}
+
+func validatePom(path string) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var pom pomProject
+	if err := xml.Unmarshal(content, &pom); err != nil {
+		return fmt.Errorf("malformed POM: %v", err)
+	}
+	if pom.ArtifactId == "" {
+		return fmt.Errorf("POM has no artifactId")
+	}
+	if pom.Version == "" && pom.Parent.Version == "" {
+		return fmt.Errorf("POM has no version")
+	}
+	return nil
+}
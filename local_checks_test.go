@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestOrphanChecksumFiles(t *testing.T) {
+	local := t.TempDir()
+	writeTree(t, local, map[string]string{
+		"org/e/lib/1.0/lib-1.0.jar.sha1": sha1Hex("jar content"),
+		"org/e/lib/1.0/lib-1.0.jar.md5":  md5Hex("jar content"),
+		"org/e/lib/1.0/lib-1.0.pom":      "<project><artifactId>lib</artifactId></project>",
+		"org/e/lib/1.0/lib-1.0.pom.sha1": sha1Hex("<project><artifactId>lib</artifactId></project>"),
+	})
+	if err := runCrawler(t, "--maven-repository", local, "--local-only"); err != nil {
+		t.Fatal(err)
+	}
+	got := findingPaths(categoryOrphanChecksum)
+	if len(got) != 2 || got[0] != "org/e/lib/1.0/lib-1.0.jar.md5" || got[1] != "org/e/lib/1.0/lib-1.0.jar.sha1" {
+		t.Errorf("orphan-checksum findings = %v, want the sidecars of the missing jar", got)
+	}
+	if !hasFailures() {
+		t.Error("orphaned checksums should fail the run")
+	}
+}
+
+func TestCheckLocalChecksums(t *testing.T) {
+	local := t.TempDir()
+	files := map[string]string{
+		"org/e/lib/1.0/lib-1.0.jar":      "jar content",
+		"org/e/lib/1.0/lib-1.0.jar.md5":  md5Hex("jar content"),
+		"org/e/lib/1.0/lib-1.0.jar.sha1": sha1Hex("jar content"),
+		"org/e/lib/2.0/lib-2.0.jar":      "jar content",
+		"org/e/lib/2.0/lib-2.0.jar.md5":  md5Hex("older content"),
+		"org/e/lib/3.0/lib-3.0.jar":      "jar content",
+		"org/e/lib/3.0/lib-3.0.jar.sha1": sha1Hex("older content"),
+	}
+	writeTree(t, local, files)
+	server, _ := serveTree(t, local)
+	if err := runCrawler(t, "--maven-repository", local, "--nexus-root", server.URL, "--repository-name", "", "--check-local-checksums"); err != nil {
+		t.Fatal(err)
+	}
+	got := findingPaths(categoryLocalChecksum)
+	if len(got) != 2 || got[0] != "org/e/lib/2.0/lib-2.0.jar" || got[1] != "org/e/lib/3.0/lib-3.0.jar" {
+		t.Errorf("local-checksum-mismatch findings = %v, want the jars with a wrong .md5 and a wrong .sha1", got)
+	}
+	// The remote serves the very same files, it's the local tree that's inconsistent.
+	if got := findingPaths(categoryChecksumMismatch); len(got) != 0 {
+		t.Errorf("checksum-mismatch findings = %v", got)
+	}
+}
+
+func TestDownloadMarkersAreReportedNotChecked(t *testing.T) {
+	local, remote := t.TempDir(), t.TempDir()
+	writeTree(t, local, map[string]string{
+		"org/e/lib/1.0/lib-1.0.jar":              "jar content",
+		"org/e/lib/1.0/lib-1.0.pom.part":         "<proj",
+		"org/e/lib/1.0/lib-1.0.pom.lastUpdated":  "#NOTE: This is a Maven SNAPSHOT resolution file",
+		"org/e/lib/1.0/_remote.repositories":     "lib-1.0.jar>central=",
+		"org/e/lib/1.0/lib-1.0-sources.jar.part": "",
+	})
+	writeTree(t, remote, map[string]string{"org/e/lib/1.0/lib-1.0.jar": "jar content"})
+	var markerRequests int64
+	tree := http.FileServer(http.Dir(remote))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".part") || strings.HasSuffix(r.URL.Path, ".lastUpdated") || strings.HasSuffix(r.URL.Path, "_remote.repositories") {
+			atomic.AddInt64(&markerRequests, 1)
+		}
+		tree.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	args := []string{"--maven-repository", local, "--nexus-root", server.URL, "--repository-name", ""}
+	if err := runCrawler(t, args...); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"org/e/lib/1.0/_remote.repositories",
+		"org/e/lib/1.0/lib-1.0-sources.jar.part",
+		"org/e/lib/1.0/lib-1.0.pom.lastUpdated",
+		"org/e/lib/1.0/lib-1.0.pom.part",
+	}
+	if got := findingPaths(categoryDownloadMarker); !reflect.DeepEqual(got, want) {
+		t.Errorf("incomplete-download findings = %v, want %v", got, want)
+	}
+	if n := atomic.LoadInt64(&markerRequests); len(repo.lostFiles) != 0 || n != 0 {
+		t.Errorf("markers lost %v, requested %v times", repo.lostFiles, n)
+	}
+
+	// Only the .part files with custom patterns.
+	atomic.StoreInt64(&markerRequests, 0)
+	if err := runCrawler(t, append(args, "--download-markers", "*.part")...); err != nil {
+		t.Fatal(err)
+	}
+	if got := findingPaths(categoryDownloadMarker); !reflect.DeepEqual(got, []string{want[1], want[3]}) {
+		t.Errorf("--download-markers *.part findings = %v", got)
+	}
+	if n := atomic.LoadInt64(&markerRequests); len(repo.lostFiles) != 2 || n != 2 {
+		t.Errorf("--download-markers *.part lost %v, requested %v times", repo.lostFiles, n)
+	}
+}
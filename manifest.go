@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// trustedFiles maps the slash separated paths of --trusted-manifest to the md5
+// and sha1 digests listed for them.
+var trustedFiles = map[string]map[string]bool{}
+
+// manifestDigests tells which digests the manifest lists, so only those are
+// computed for it.
+var manifestDigests digests
+
+// loadTrustedManifest reads a manifest in md5sum/sha1sum style, one
+// "<hash>  <path>" per line with the path relative to the repository root. A
+// file is trusted only at a listed path and with a digest listed for it, the
+// same content elsewhere is checked like any other file. Blank lines and #
+// comments are ignored.
+func loadTrustedManifest(manifest string) error {
+	file, err := os.Open(manifest)
+	if err != nil {
+		return fmt.Errorf("--trusted-manifest: %v", err)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		end := strings.IndexAny(text, " \t")
+		if end < 0 {
+			return fmt.Errorf("--trusted-manifest %v:%v: %q has no path after the hash", manifest, line, text)
+		}
+		digest := strings.ToLower(text[:end])
+		switch len(digest) {
+		case 32:
+			manifestDigests.md5 = true
+		case 40:
+			manifestDigests.sha1 = true
+		default:
+			return fmt.Errorf("--trusted-manifest %v:%v: %q is neither an md5 nor a sha1", manifest, line, text[:end])
+		}
+		// sha1sum marks files hashed in binary mode with a leading *.
+		listed := manifestPath(strings.TrimPrefix(strings.TrimSpace(text[end:]), "*"))
+		if trustedFiles[listed] == nil {
+			trustedFiles[listed] = map[string]bool{}
+		}
+		trustedFiles[listed][digest] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("--trusted-manifest: %v", err)
+	}
+	return nil
+}
+
+// manifestPath normalizes a repository relative path to the manifest keys.
+func manifestPath(p string) string {
+	return strings.TrimPrefix(path.Clean(filepath.ToSlash(p)), "./")
+}
+
+// isTrusted tells whether the manifest vouches for a walked file: its path is
+// listed and its content hashes to a digest listed for that path.
+func isTrusted(artifact LocalArtifact) bool {
+	if len(trustedFiles) == 0 || artifact.isDir || artifact.err != nil {
+		return false
+	}
+	listed := trustedFiles[manifestPath(artifact.path)]
+	return (artifact.md5 != "" && listed[artifact.md5]) || (artifact.sha1 != "" && listed[artifact.sha1])
+}
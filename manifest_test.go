@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestTrustedManifestSkipsManifestedFiles(t *testing.T) {
+	local, remote := t.TempDir(), t.TempDir()
+	writeTree(t, local, map[string]string{
+		"org/e/lib/1.0/lib-1.0.jar":         "jar content",
+		"org/e/lib/1.0/lib-1.0.pom":         "<project/>",
+		"org/e/lib/1.0/lib-1.0-sources.jar": "sources",
+		"org/e/lib/2.0/lib-2.0.jar":         "jar content",
+	})
+	// Not even the trusted jar is on the remote, it mustn't be asked for.
+	writeTree(t, remote, map[string]string{"org/e/lib/1.0/lib-1.0-sources.jar": "sources"})
+	manifest := filepath.Join(t.TempDir(), "SHA1SUMS")
+	content := "# known good\n" +
+		md5Hex("jar content") + "  ./org/e/lib/1.0/lib-1.0.jar\n" +
+		"\n" +
+		sha1Hex("<project>changed</project>") + " *org/e/lib/1.0/lib-1.0.pom\n"
+	if err := os.WriteFile(manifest, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tree := http.FileServer(http.Dir(remote))
+	var mu sync.Mutex
+	var requested []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested = append(requested, r.URL.Path)
+		mu.Unlock()
+		tree.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	if err := runCrawler(t, "--maven-repository", local, "--nexus-root", server.URL, "--repository-name", "",
+		"--trusted-manifest", manifest, "--dir-check", "none", "--no-preflight"); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(requested)
+	// The POM changed since the manifest and the 2.0 jar is at a path it doesn't list.
+	want := []string{"/org/e/lib/1.0/lib-1.0-sources.jar", "/org/e/lib/1.0/lib-1.0.pom", "/org/e/lib/2.0/lib-2.0.jar"}
+	if strings.Join(requested, " ") != strings.Join(want, " ") {
+		t.Errorf("requested %v, want %v", requested, want)
+	}
+	if repo.trusted != 1 {
+		t.Errorf("%v files trusted, want the 1.0 jar", repo.trusted)
+	}
+
+	if err := os.WriteFile(manifest, []byte("not-a-digest  org/e/lib/1.0/lib-1.0.jar\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	resetRun(t)
+	if err := loadTrustedManifest(manifest); err == nil {
+		t.Error("a manifest line without a digest was accepted")
+	}
+}
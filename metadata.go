@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+)
+
+const metadataFileName = "maven-metadata.xml"
+
+// mavenMetadata is the artifact or SNAPSHOT version level maven-metadata.xml.
+type mavenMetadata struct {
+	GroupId    string `xml:"groupId"`
+	ArtifactId string `xml:"artifactId"`
+	Versioning struct {
+		Latest   string   `xml:"latest"`
+		Release  string   `xml:"release"`
+		Versions []string `xml:"versions>version"`
+		// SnapshotVersions is only present in the metadata of a SNAPSHOT
+		// version directory.
+		SnapshotVersions []snapshotVersion `xml:"snapshotVersions>snapshotVersion"`
+	} `xml:"versioning"`
+}
+
+// metadataVersionArtifacts parses the maven-metadata.xml at relPath and returns
+// the version directories it lists that exists reports absent from the local
+// tree, so they are checked remotely as well. Unparsable metadata yields
+// nothing.
+func metadataVersionArtifacts(relPath string, content []byte, exists func(dir string) bool) []LocalArtifact {
+	var metadata mavenMetadata
+	if err := xml.Unmarshal(content, &metadata); err != nil {
+		return nil
+	}
+	versioning := metadata.Versioning
+	seen := map[string]bool{}
+	var artifacts []LocalArtifact
+	for _, version := range append([]string{versioning.Latest, versioning.Release}, versioning.Versions...) {
+		if version == "" || seen[version] {
+			continue
+		}
+		seen[version] = true
+		dir := filepath.Join(filepath.Dir(relPath), version)
+		if !exists(dir) {
+			artifacts = append(artifacts, LocalArtifact{path: dir, isDir: true, fromMetadata: true})
+		}
+	}
+	return artifacts
+}
+
+// dirExists tells whether dir below root exists. Anything but a plain absence
+// counts as existing, the walk reports unreadable directories itself.
+func dirExists(root string) func(dir string) bool {
+	return func(dir string) bool {
+		_, err := os.Stat(filepath.Join(root, dir))
+		return !os.IsNotExist(err)
+	}
+}
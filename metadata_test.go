@@ -0,0 +1,58 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+const libMetadata = `<metadata>
+  <groupId>org.e</groupId>
+  <artifactId>lib</artifactId>
+  <versioning>
+    <latest>3.0</latest>
+    <versions><version>1.0</version><version>2.0</version><version>3.0</version></versions>
+  </versioning>
+</metadata>`
+
+func TestFollowMetadataChecksVersionsAbsentLocally(t *testing.T) {
+	local, remote := t.TempDir(), t.TempDir()
+	writeTree(t, local, map[string]string{
+		"org/e/lib/maven-metadata.xml": libMetadata,
+		"org/e/lib/1.0/lib-1.0.jar":    "jar content",
+	})
+	writeTree(t, remote, map[string]string{
+		"org/e/lib/maven-metadata.xml": libMetadata,
+		"org/e/lib/1.0/lib-1.0.jar":    "jar content",
+		"org/e/lib/2.0/lib-2.0.jar":    "jar content",
+	})
+	server, _ := serveTree(t, remote)
+	if err := runCrawler(t, "--maven-repository", local, "--nexus-root", server.URL, "--repository-name", "", "--follow-metadata"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{server.URL + "/org/e/lib/3.0"}
+	if got := findingPaths(categoryMetadataVersion); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("metadata-version-missing findings = %v, want %v", got, want)
+	}
+	if len(repo.lostDirs) != 0 || len(repo.lostFiles) != 0 {
+		t.Errorf("versions listed only in the metadata were counted lost: %v %v", repo.lostDirs, repo.lostFiles)
+	}
+}
+
+func TestMetadataVersionArtifacts(t *testing.T) {
+	exists := func(dir string) bool { return dir == "org/e/lib/1.0" }
+	var dirs []string
+	for _, a := range metadataVersionArtifacts("org/e/lib/maven-metadata.xml", []byte(libMetadata), exists) {
+		if !a.isDir || !a.fromMetadata {
+			t.Errorf("%v is not a version directory from the metadata", a.path)
+		}
+		dirs = append(dirs, a.path)
+	}
+	sort.Strings(dirs)
+	if got := strings.Join(dirs, ","); got != "org/e/lib/2.0,org/e/lib/3.0" {
+		t.Errorf("versions to check = %v", got)
+	}
+	if got := metadataVersionArtifacts("org/e/lib/maven-metadata.xml", []byte("<metadata>"), exists); len(got) != 0 {
+		t.Errorf("unparsable metadata yielded %v", got)
+	}
+}
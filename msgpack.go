@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// writeMsgpack writes v as MessagePack. The schema is the JSON one: structs
+// are maps keyed by their json tag names, honouring omitempty, so consumers
+// can share it across both formats.
+func writeMsgpack(path string, v interface{}) error {
+	file, err := createReport(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	if err := encodeMsgpack(w, reflect.ValueOf(v)); err != nil {
+		file.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func encodeMsgpack(w *bufio.Writer, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			return w.WriteByte(0xc0)
+		}
+		return encodeMsgpack(w, v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			return w.WriteByte(0xc3)
+		}
+		return w.WriteByte(0xc2)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return writeMsgpackInt(w, v.Int())
+	case reflect.Float32, reflect.Float64:
+		w.WriteByte(0xcb)
+		return binary.Write(w, binary.BigEndian, math.Float64bits(v.Float()))
+	case reflect.String:
+		return writeMsgpackString(w, v.String())
+	case reflect.Slice:
+		if v.IsNil() {
+			return w.WriteByte(0xc0)
+		}
+		writeMsgpackHeader(w, 0x90, 0xdc, 0xdd, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			if err := encodeMsgpack(w, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		if v.IsNil() {
+			return w.WriteByte(0xc0)
+		}
+		if v.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("msgpack: unsupported map key %v", v.Type().Key())
+		}
+		// Sorted keys keep the output reproducible.
+		keys := make([]string, 0, v.Len())
+		for _, k := range v.MapKeys() {
+			keys = append(keys, k.String())
+		}
+		sort.Strings(keys)
+		writeMsgpackHeader(w, 0x80, 0xde, 0xdf, len(keys))
+		for _, k := range keys {
+			writeMsgpackString(w, k)
+			if err := encodeMsgpack(w, v.MapIndex(reflect.ValueOf(k).Convert(v.Type().Key()))); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Struct:
+		type field struct {
+			name  string
+			value reflect.Value
+		}
+		var fields []field
+		for i := 0; i < v.NumField(); i++ {
+			name, omitEmpty := jsonField(v.Type().Field(i))
+			if name == "" || (omitEmpty && isEmptyValue(v.Field(i))) {
+				continue
+			}
+			fields = append(fields, field{name, v.Field(i)})
+		}
+		writeMsgpackHeader(w, 0x80, 0xde, 0xdf, len(fields))
+		for _, f := range fields {
+			writeMsgpackString(w, f.name)
+			if err := encodeMsgpack(w, f.value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("msgpack: unsupported type %v", v.Type())
+}
+
+// jsonField returns the json tag name of an exported field, empty for fields
+// left out of the JSON schema.
+func jsonField(f reflect.StructField) (string, bool) {
+	if f.PkgPath != "" {
+		return "", false
+	}
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+	name, options, _ := strings.Cut(tag, ",")
+	if name == "" {
+		name = f.Name
+	}
+	return name, options == "omitempty"
+}
+
+// isEmptyValue reports whether omitempty leaves v out, as encoding/json does.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
+
+func writeMsgpackInt(w *bufio.Writer, n int64) error {
+	switch {
+	case n >= 0 && n <= 0x7f:
+		return w.WriteByte(byte(n))
+	case n < 0 && n >= -32:
+		return w.WriteByte(byte(n))
+	case n >= math.MinInt32 && n <= math.MaxInt32:
+		w.WriteByte(0xd2)
+		return binary.Write(w, binary.BigEndian, int32(n))
+	}
+	w.WriteByte(0xd3)
+	return binary.Write(w, binary.BigEndian, n)
+}
+
+func writeMsgpackString(w *bufio.Writer, s string) error {
+	if len(s) <= 31 {
+		w.WriteByte(0xa0 | byte(len(s)))
+	} else {
+		writeMsgpackHeader(w, 0xa0, 0xda, 0xdb, len(s))
+	}
+	_, err := io.WriteString(w, s)
+	return err
+}
+
+// writeMsgpackHeader writes the length of a string, array or map: fixed in
+// the first byte for short ones, otherwise as a 16 or 32 bit length. Strings
+// use it only past the 31 bytes fixstr holds.
+func writeMsgpackHeader(w *bufio.Writer, fixed, code16, code32 byte, n int) {
+	switch {
+	case n <= 15 && fixed != 0xa0:
+		w.WriteByte(fixed | byte(n))
+	case n <= math.MaxUint16:
+		w.WriteByte(code16)
+		binary.Write(w, binary.BigEndian, uint16(n))
+	default:
+		w.WriteByte(code32)
+		binary.Write(w, binary.BigEndian, uint32(n))
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// decodeMsgpack is a minimal decoder of what writeMsgpack emits, numbers
+// decoded as float64 to compare with encoding/json.
+func decodeMsgpack(r *bufio.Reader) (interface{}, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	length := func(size int) (int, error) {
+		switch size {
+		case 2:
+			var n uint16
+			err := binary.Read(r, binary.BigEndian, &n)
+			return int(n), err
+		default:
+			var n uint32
+			err := binary.Read(r, binary.BigEndian, &n)
+			return int(n), err
+		}
+	}
+	var n int
+	switch {
+	case b <= 0x7f:
+		return float64(b), nil
+	case b >= 0xe0:
+		return float64(int8(b)), nil
+	case b&0xe0 == 0xa0:
+		return readMsgpackString(r, int(b&0x1f))
+	case b&0xf0 == 0x90:
+		return decodeMsgpackArray(r, int(b&0x0f))
+	case b&0xf0 == 0x80:
+		return decodeMsgpackMap(r, int(b&0x0f))
+	case b == 0xc0:
+		return nil, nil
+	case b == 0xc2 || b == 0xc3:
+		return b == 0xc3, nil
+	case b == 0xd2:
+		var i int32
+		err := binary.Read(r, binary.BigEndian, &i)
+		return float64(i), err
+	case b == 0xd3:
+		var i int64
+		err := binary.Read(r, binary.BigEndian, &i)
+		return float64(i), err
+	case b == 0xcb:
+		var bits uint64
+		err := binary.Read(r, binary.BigEndian, &bits)
+		return math.Float64frombits(bits), err
+	case b == 0xda || b == 0xdb:
+		if n, err = length(map[byte]int{0xda: 2, 0xdb: 4}[b]); err != nil {
+			return nil, err
+		}
+		return readMsgpackString(r, n)
+	case b == 0xdc || b == 0xdd:
+		if n, err = length(map[byte]int{0xdc: 2, 0xdd: 4}[b]); err != nil {
+			return nil, err
+		}
+		return decodeMsgpackArray(r, n)
+	case b == 0xde || b == 0xdf:
+		if n, err = length(map[byte]int{0xde: 2, 0xdf: 4}[b]); err != nil {
+			return nil, err
+		}
+		return decodeMsgpackMap(r, n)
+	}
+	return nil, fmt.Errorf("msgpack: unexpected byte %#x", b)
+}
+
+func readMsgpackString(r *bufio.Reader, n int) (string, error) {
+	s := make([]byte, n)
+	_, err := io.ReadFull(r, s)
+	return string(s), err
+}
+
+func decodeMsgpackArray(r *bufio.Reader, n int) (interface{}, error) {
+	a := make([]interface{}, n)
+	for i := range a {
+		var err error
+		if a[i], err = decodeMsgpack(r); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+func decodeMsgpackMap(r *bufio.Reader, n int) (interface{}, error) {
+	m := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		k, err := decodeMsgpack(r)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			return nil, fmt.Errorf("msgpack: map key %v is not a string", k)
+		}
+		if m[key], err = decodeMsgpack(r); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func TestMsgpackRoundTripsTheJSONReport(t *testing.T) {
+	local, remote, out := t.TempDir(), t.TempDir(), t.TempDir()
+	mirrorTree(t, local, remote, 40)
+	// A URL past the 255 bytes of a short string length.
+	writeTree(t, local, map[string]string{"org/e/lib/1/lib-1-" + strings.Repeat("c", 200) + ".jar": "jar content"})
+	server, _ := serveTree(t, remote)
+	jsonFile, msgpackFile := filepath.Join(out, "missing.json"), filepath.Join(out, "missing.msgpack")
+	if err := runCrawler(t, "--maven-repository", local, "--nexus-root", server.URL, "--repository-name", "",
+		"--json", "--json-file", jsonFile, "--msgpack-file", msgpackFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeReports(); err != nil {
+		t.Fatal(err)
+	}
+	var fromJSON interface{}
+	readJSON(t, jsonFile, &fromJSON)
+	content, err := os.ReadFile(msgpackFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := bufio.NewReader(bytes.NewReader(content))
+	fromMsgpack, err := decodeMsgpack(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.ReadByte(); err != io.EOF {
+		t.Error("trailing bytes after the report")
+	}
+	if !reflect.DeepEqual(fromMsgpack, fromJSON) {
+		t.Errorf("the MessagePack report differs from the JSON one:\n%v\n%v", fromMsgpack, fromJSON)
+	}
+}
+
+func TestMsgpackEncodesEveryLength(t *testing.T) {
+	for _, v := range []interface{}{
+		int64(-1), int64(-33), int64(127), int64(128), int64(math.MaxInt32 + 1), 1.5, true, false,
+		strings.Repeat("s", 31), strings.Repeat("s", 32), strings.Repeat("s", 70000),
+		make([]interface{}, 15), make([]interface{}, 16),
+	} {
+		var buf bytes.Buffer
+		w := bufio.NewWriter(&buf)
+		if err := encodeMsgpack(w, reflect.ValueOf(v)); err != nil {
+			t.Fatal(err)
+		}
+		w.Flush()
+		got, err := decodeMsgpack(bufio.NewReader(&buf))
+		if err != nil {
+			t.Fatalf("decoding %.40v: %v", v, err)
+		}
+		var want interface{}
+		encoded, _ := json.Marshal(v)
+		json.Unmarshal(encoded, &want)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%.40v round trips as %.40v", v, got)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// headUnsupported is set by the preflight when the remote rejects HEAD
+// altogether, switching every probe to a ranged GET.
+var headUnsupported bool
+
+// loginPathMarkers are substrings of a redirect target that indicate an SSO or
+// login gateway rather than the repository itself.
+var loginPathMarkers = []string{"login", "signin", "sso", "auth"}
+
+// preflight issues a single HEAD against the repository root so that an
+// unreachable remote, missing credentials or a login redirect abort the run
+// before the local tree is walked. The outcome is recorded in repo.preflight.
+func preflight(client *http.Client, group string) error {
+	url := remoteURL(repo.basePathRemote, group, "")
+	noRedirects := withoutRedirects(client)
+	resp, err := noRedirects.Head(url)
+	if err != nil {
+		repo.preflight = fmt.Sprintf("failed: %v is unreachable", url)
+		return fmt.Errorf("preflight: cannot connect to %v: %v", url, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusNotImplemented || resp.StatusCode == http.StatusMethodNotAllowed {
+		if getResp, err := rangedGet(noRedirects, url); err == nil && getResp.StatusCode != resp.StatusCode {
+			headUnsupported = true
+			log.Printf("Preflight: %v answered HEAD with %v, probing with ranged GETs instead", url, resp.Status)
+			resp = getResp
+		}
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		repo.preflight = fmt.Sprintf("failed: %v", resp.Status)
+		return fmt.Errorf("preflight: %v answered %v, authentication is required or the credentials are not accepted", url, resp.Status)
+	case resp.StatusCode >= 300 && resp.StatusCode < 400:
+		location := resp.Header.Get("Location")
+		if isLoginRedirect(location) {
+			repo.preflight = fmt.Sprintf("failed: redirected to %v", location)
+			return fmt.Errorf("preflight: %v redirects to a login page (%v), authentication is required", url, location)
+		}
+		repo.preflight = fmt.Sprintf("ok: %v redirects to %v", url, location)
+	default:
+		repo.preflight = fmt.Sprintf("ok: %v answered %v", url, resp.Status)
+	}
+	return nil
+}
+
+// checkCertificates runs checkCertExpiry once for every host of --nexus-root
+// and --compare-remote, with or without the preflight. A host that can't be
+// reached is left to the crawl to report.
+func checkCertificates(client *http.Client) {
+	noRedirects := withoutRedirects(client)
+	checked := map[string]bool{}
+	for _, remote := range append(nexusRoots[:len(nexusRoots):len(nexusRoots)], *compareRemote) {
+		u, err := url.Parse(remote)
+		if remote == "" || err != nil || u.Scheme == "file" || checked[u.Host] {
+			continue
+		}
+		checked[u.Host] = true
+		resp, err := noRedirects.Head(remote)
+		if err != nil {
+			log.Printf("Cannot check the certificate of %v: %v", remote, err)
+			continue
+		}
+		resp.Body.Close()
+		checkCertExpiry(remote, resp.TLS)
+	}
+}
+
+// checkCertExpiry logs the certificate the remote presented and files it as
+// cert-expiring when it expires within --check-cert-expiry, as every request
+// will fail soon after.
+func checkCertExpiry(url string, state *tls.ConnectionState) {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		log.Printf("%v is not served over TLS, there is no certificate to check", url)
+		return
+	}
+	cert := state.PeerCertificates[0]
+	left := time.Until(cert.NotAfter).Round(time.Minute)
+	log.Printf("Certificate of %v: subject %v, issuer %v, not after %v", url, cert.Subject, cert.Issuer, formatTime(cert.NotAfter))
+	if left < *certExpiry {
+		repo.addFinding(categoryCertExpiry, url, fmt.Sprintf("certificate %v issued by %v expires %v, in %v",
+			cert.Subject, cert.Issuer, formatTime(cert.NotAfter), left))
+	}
+}
+
+// withoutRedirects is client with redirects returned rather than followed.
+func withoutRedirects(client *http.Client) *http.Client {
+	noRedirects := *client
+	noRedirects.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	return &noRedirects
+}
+
+// rangedGet requests just the first byte of url, the cheapest GET that still
+// tells whether it exists.
+func rangedGet(client *http.Client, url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", "bytes=0-0")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return resp, nil
+}
+
+func isLoginRedirect(location string) bool {
+	location = strings.ToLower(location)
+	for _, marker := range loginPathMarkers {
+		if strings.Contains(location, marker) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPreflightAbortsOnUnauthorized(t *testing.T) {
+	local := t.TempDir()
+	writeTree(t, local, map[string]string{"org/e/lib/1.0/lib-1.0.jar": "jar content"})
+	var requests int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+	err := runCrawler(t, "--maven-repository", local, "--nexus-root", server.URL)
+	if err == nil || !strings.Contains(err.Error(), "authentication is required") {
+		t.Fatalf("preflight error = %v, want an authentication error", err)
+	}
+	if n := atomic.LoadInt64(&requests); n != 1 {
+		t.Errorf("%v requests sent, want the preflight only", n)
+	}
+	if !strings.HasPrefix(repo.preflight, "failed") {
+		t.Errorf("preflight summary = %q", repo.preflight)
+	}
+}
+
+func TestPreflightAbortsOnLoginRedirect(t *testing.T) {
+	resetRun(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/sso/login?next=/ga", http.StatusFound)
+	}))
+	defer server.Close()
+	repo = Repository{basePathRemote: server.URL, findings: map[string][]Finding{}}
+	if err := preflight(server.Client(), "ga"); err == nil || !strings.Contains(err.Error(), "login page") {
+		t.Errorf("preflight error = %v, want a login redirect error", err)
+	}
+}
+
+func TestPreflightPasses(t *testing.T) {
+	resetRun(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	repo = Repository{basePathRemote: server.URL, findings: map[string][]Finding{}}
+	if err := preflight(server.Client(), "ga"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(repo.preflight, "ok") {
+		t.Errorf("preflight summary = %q", repo.preflight)
+	}
+}
+
+func TestProbesFallBackToGETWithoutHEAD(t *testing.T) {
+	local, remote := t.TempDir(), t.TempDir()
+	mirrorTree(t, local, remote, 3)
+	tree := http.FileServer(http.Dir(remote))
+	var heads, unranged int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			atomic.AddInt64(&heads, 1)
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		}
+		if r.Header.Get("Range") == "" {
+			atomic.AddInt64(&unranged, 1)
+		}
+		tree.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	if err := runCrawler(t, "--maven-repository", local, "--nexus-root", server.URL, "--repository-name", ""); err != nil {
+		t.Fatal(err)
+	}
+	if !headUnsupported || !strings.Contains(repo.preflight, "ok") {
+		t.Errorf("HEAD unsupported %v, preflight %q", headUnsupported, repo.preflight)
+	}
+	if heads != 1 || unranged != 0 {
+		t.Errorf("%v HEADs and %v GETs without a range, want the preflight HEAD only", heads, unranged)
+	}
+	if len(repo.lostDirs) != 1 || len(repo.lostFiles) != 2 || repo.present != checkedCount()-3 {
+		t.Errorf("lost %v and %v, %v of %v present, want only version 0 lost", repo.lostDirs, repo.lostFiles, repo.present, checkedCount())
+	}
+}
+
+// certificateExpiring makes a self-signed certificate for 127.0.0.1 that
+// expires after lifetime.
+func certificateExpiring(t *testing.T, lifetime time.Duration) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "nexus.test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(lifetime),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestCheckCertExpiry(t *testing.T) {
+	for _, test := range []struct {
+		lifetime time.Duration
+		expiring bool
+	}{
+		{48 * time.Hour, true},
+		{365 * 24 * time.Hour, false},
+	} {
+		resetRun(t)
+		*certExpiry = 30 * 24 * time.Hour
+		server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		server.TLS = &tls.Config{Certificates: []tls.Certificate{certificateExpiring(t, test.lifetime)}}
+		server.StartTLS()
+		repo = Repository{findings: map[string][]Finding{}}
+		nexusRoots = stringList{server.URL}
+		checkCertificates(server.Client())
+		server.Close()
+		if got := findingPaths(categoryCertExpiry); (len(got) == 1) != test.expiring || len(got) > 1 {
+			t.Errorf("certificate expiring in %v: cert-expiring findings %v", test.lifetime, got)
+		}
+	}
+
+	// A plain HTTP remote has no certificate to expire.
+	resetRun(t)
+	*certExpiry = 30 * 24 * time.Hour
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	repo = Repository{findings: map[string][]Finding{}}
+	nexusRoots = stringList{server.URL}
+	checkCertificates(server.Client())
+	if got := findingPaths(categoryCertExpiry); len(got) != 0 {
+		t.Errorf("plain HTTP: cert-expiring findings %v", got)
+	}
+}
+
+func TestCheckCertExpiryOfEveryRemoteHost(t *testing.T) {
+	resetRun(t)
+	*certExpiry = 30 * 24 * time.Hour
+	var freshRequests int64
+	fresh := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&freshRequests, 1)
+	}))
+	fresh.TLS = &tls.Config{Certificates: []tls.Certificate{certificateExpiring(t, 365*24*time.Hour)}}
+	fresh.StartTLS()
+	defer fresh.Close()
+	expiring := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	expiring.TLS = &tls.Config{Certificates: []tls.Certificate{certificateExpiring(t, 48*time.Hour)}}
+	expiring.StartTLS()
+	defer expiring.Close()
+	pool := x509.NewCertPool()
+	pool.AddCert(fresh.Certificate())
+	pool.AddCert(expiring.Certificate())
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+
+	// The expiring certificate is only on the mirror and the compare remote,
+	// neither of which the preflight looks at.
+	repo = Repository{findings: map[string][]Finding{}}
+	nexusRoots = stringList{fresh.URL, fresh.URL + "/mirror", expiring.URL}
+	*compareRemote = expiring.URL
+	checkCertificates(client)
+	if got := findingPaths(categoryCertExpiry); len(got) != 1 || got[0] != expiring.URL {
+		t.Errorf("cert-expiring findings %v, want %v", got, expiring.URL)
+	}
+	if n := atomic.LoadInt64(&freshRequests); n != 1 {
+		t.Errorf("%v requests to check the certificate of one host", n)
+	}
+}
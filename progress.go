@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// walked counts the local artifacts done with, collected or filtered out by
+// the workers, over all groups. Versions listed only in maven-metadata.xml
+// aren't counted, the --precount pass doesn't read file contents.
+var walked int64
+
+// precounted is the number of local artifacts the check walks, counted by
+// --precount before the crawl, 0 without it.
+var precounted int64
+
+// precount walks the local roots once the way scanLocalPath does, counting
+// the artifacts it will emit without hashing or checking anything. Every
+// group walks the same tree, so the count is taken once and reused for all.
+func precount() {
+	var count int64
+	for _, root := range mavenRoots {
+		filepath.Walk(filepath.Join(root, *prefix), func(path string, f os.FileInfo, err error) error {
+			if err == nil && !f.IsDir() && f.ModTime().Before(sinceTime) {
+				return nil
+			}
+			count++
+			return nil
+		})
+	}
+	atomic.StoreInt64(&precounted, count*int64(len(repoGroups)))
+}
+
+// progress renders how much of the walk is done, as a percentage of the
+// --precount total when there is one. A tree changing between the two walks
+// can leave it off its 100%.
+func progress() string {
+	done := atomic.LoadInt64(&walked)
+	total := atomic.LoadInt64(&precounted)
+	if total == 0 {
+		return fmt.Sprintf("%v walked", done)
+	}
+	return fmt.Sprintf("%v of %v walked (%.1f%%)", done, total, 100*float64(done)/float64(total))
+}
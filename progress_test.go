@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestPrecountReachesExactly100Percent(t *testing.T) {
+	local, remote := t.TempDir(), t.TempDir()
+	mirrorTree(t, local, filepath.Join(remote, "a"), 5)
+	mirrorTree(t, local, filepath.Join(remote, "b"), 5)
+	server, _ := serveTree(t, remote)
+	for _, args := range [][]string{
+		{"--repository-name", "a"},
+		{"--repository-name", "a,b"},
+		{"--repository-name", "a,b", "--dir-check", "none", "--threads", "7"},
+	} {
+		if err := runCrawler(t, append([]string{"--maven-repository", local, "--nexus-root", server.URL, "--precount"}, args...)...); err != nil {
+			t.Fatal(err)
+		}
+		// The root, org, org/e, org/e/lib and 5 versions of 2 files each, per group.
+		total := (4 + 5*3) * len(repoGroups)
+		if got, want := progress(), fmt.Sprintf("%v of %v walked (100.0%%)", total, total); got != want {
+			t.Errorf("%v: progress %q, want %q", args, got, want)
+		}
+	}
+}
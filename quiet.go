@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"sync"
+)
+
+// heldLog keeps the log of a --quiet-on-success run until its outcome is
+// known: a clean run drops it, any other run has it written out in full.
+type heldLog struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (h *heldLog) Write(p []byte) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.buf.Write(p)
+}
+
+var quietLog *heldLog
+
+// holdLog starts holding the log back for --quiet-on-success.
+func holdLog() {
+	quietLog = &heldLog{}
+	log.SetOutput(timestampWriter{quietLog})
+}
+
+// cleanRun tells whether the run passed outright, exactly when it exits 0: it
+// didn't fail and hasFailures finds nothing. Warnings don't spoil it, unless
+// --strict makes them failures.
+func cleanRun(err error) bool {
+	return err == nil && !hasFailures()
+}
+
+// releaseLog stops holding the log. A clean run gets a single success line
+// and true, any other run gets the held log written to stderr and false, the
+// full summary is up to the caller then.
+func releaseLog(err error) bool {
+	log.SetOutput(timestampWriter{os.Stderr})
+	if cleanRun(err) {
+		log.Printf("Clean: %v artifacts checked, nothing lost", checkedCount())
+		return true
+	}
+	quietLog.mu.Lock()
+	defer quietLog.mu.Unlock()
+	os.Stderr.Write(quietLog.buf.Bytes())
+	return false
+}
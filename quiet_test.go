@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestQuietOnSuccess(t *testing.T) {
+	local, remote, out := t.TempDir(), t.TempDir(), t.TempDir()
+	mirrorTree(t, local, remote, 3)
+	server, _ := serveTree(t, remote)
+	args := []string{"--nexus-root", server.URL, "--repository-name", "", "--quiet-on-success", "--json"}
+
+	// Without the version 0 the remote lacks, the crawl is clean.
+	cleanLocal := t.TempDir()
+	mirrorTree(t, cleanLocal, t.TempDir(), 3)
+	if err := os.RemoveAll(filepath.Join(cleanLocal, "org/e/lib/0")); err != nil {
+		t.Fatal(err)
+	}
+	clean := filepath.Join(out, "clean.json")
+	code, output := runMain(t, append(args, "--maven-repository", cleanLocal, "--json-file", clean)...)
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if code != 0 || len(lines) != 1 || !strings.Contains(lines[0], "Clean: 10 artifacts checked, nothing lost") {
+		t.Errorf("clean run: exit code %v, output %q", code, output)
+	}
+	if _, err := os.Stat(clean); err != nil {
+		t.Errorf("clean run: %v", err)
+	}
+
+	dirty := filepath.Join(out, "dirty.json")
+	code, output = runMain(t, append(args, "--maven-repository", local, "--json-file", dirty)...)
+	// The held log and the full summary, and the lost files fail the run.
+	if code != exitFindings || strings.Contains(output, "Clean:") || !strings.Contains(output, "Preflight: ok") || !strings.Contains(output, server.URL+"/org/e/lib/0/lib-0.jar") {
+		t.Errorf("dirty run: exit code %v, output %q", code, output)
+	}
+	if _, err := os.Stat(dirty); err != nil {
+		t.Errorf("dirty run: %v", err)
+	}
+
+	// A forbidden file is only a warning, the run stays clean until --strict.
+	tree := http.FileServer(http.Dir(remote))
+	forbidding := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "lib-1.jar") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		tree.ServeHTTP(w, r)
+	}))
+	defer forbidding.Close()
+	warned := []string{"--nexus-root", forbidding.URL, "--repository-name", "", "--quiet-on-success", "--maven-repository", cleanLocal}
+	code, output = runMain(t, warned...)
+	if code != 0 || !strings.Contains(output, "Clean:") {
+		t.Errorf("run with a warning: exit code %v, output %q", code, output)
+	}
+	code, output = runMain(t, append(warned, "--strict")...)
+	if code != exitFindings || strings.Contains(output, "Clean:") {
+		t.Errorf("run with a warning and --strict: exit code %v, output %q", code, output)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+)
+
+// Reconcile actions making the local mirror match the remote.
+const (
+	actionDelete   = "delete"
+	actionDownload = "download"
+	// actionRecheck deletes nothing: the remote couldn't tell whether it has
+	// the file, it timed out or kept failing with a 5xx or 429.
+	actionRecheck = "recheck"
+)
+
+// reconcileReport is the layout of the --reconcile-report file. The remote is
+// authoritative: local files it lacks are to be deleted, local copies that
+// differ from it downloaded again. Files the remote failed to answer for are
+// to be checked again rather than deleted. Files only the remote has aren't listed,
+// that would take a listing of the remote.
+type reconcileReport struct {
+	SchemaVersion int              `json:"schemaVersion"`
+	RunID         string           `json:"runId"`
+	Entries       []reconcileEntry `json:"entries"`
+}
+
+// reconcileEntry is the action to take on one local file.
+type reconcileEntry struct {
+	Action string `json:"action"`
+	// Path is the local file, URL where it is or should be on the remote.
+	Path   string `json:"path"`
+	URL    string `json:"url"`
+	Reason string `json:"reason"`
+	// relPath keys the entry across repository groups.
+	relPath string
+}
+
+// reconcileResult records the action a classified result calls for, if any.
+func (r *Repository) reconcileResult(result Result, outcome string) {
+	if result.isDir {
+		return
+	}
+	where := localPath(result.root, result.relPath)
+	if outcome == outcomeLost {
+		action := actionRecheck
+		if result.code == http.StatusNotFound || result.code == http.StatusGone {
+			action = actionDelete
+		}
+		r.reconcile = append(r.reconcile, reconcileEntry{action, where, result.path, "remote answered " + result.status, result.relPath})
+		return
+	}
+	if result.hasFinding(categoryChecksumMismatch) {
+		r.reconcile = append(r.reconcile, reconcileEntry{actionDownload, where, result.path, "local checksum differs from the remote", result.relPath})
+	}
+}
+
+// reconcileEntries lists the actions ordered by path. A file lost in one
+// repository group but present in another is kept, and neither deleted nor
+// checked again. A file some group failed to answer for isn't deleted.
+func reconcileEntries() []reconcileEntry {
+	entries := []reconcileEntry{}
+	seen := map[string]bool{}
+	recheck := map[string]bool{}
+	for _, e := range repo.reconcile {
+		if e.Action == actionRecheck {
+			recheck[e.relPath] = true
+		}
+	}
+	for _, e := range repo.reconcile {
+		if (e.Action == actionDelete || e.Action == actionRecheck) && len(repo.presentIn[e.relPath]) > 0 {
+			continue
+		}
+		if e.Action == actionDelete && recheck[e.relPath] {
+			// Another group failed to answer, the file may well be there.
+			continue
+		}
+		if key := e.Action + " " + e.Path; !seen[key] {
+			seen[key] = true
+			entries = append(entries, e)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+	return entries
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReconcileReport(t *testing.T) {
+	local, remote, out := t.TempDir(), t.TempDir(), t.TempDir()
+	mirrorTree(t, local, filepath.Join(remote, "a"), 3)
+	if err := os.Remove(filepath.Join(remote, "a/org/e/lib/1/lib-1.pom")); err != nil {
+		t.Fatal(err)
+	}
+	// The version 0 the group a lacks is in the group b.
+	writeTree(t, filepath.Join(remote, "b"), map[string]string{
+		"org/e/lib/0/lib-0.jar":     "jar content",
+		"org/e/lib/0/lib-0.pom":     "<project/>",
+		"org/e/lib/1/lib-1.jar":     "jar content",
+		"org/e/lib/1/lib-1.jar.md5": md5Hex("older content"),
+	})
+	writeTree(t, filepath.Join(remote, "a"), map[string]string{"org/e/lib/1/lib-1.jar.md5": md5Hex("older content")})
+	tree := http.FileServer(http.Dir(remote))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/a/org/e/lib/2/lib-2.jar" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		tree.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	reconcileFile := filepath.Join(out, "reconcile.json")
+	if err := runCrawler(t, "--maven-repository", local, "--nexus-root", server.URL, "--repository-name", "a,b",
+		"--md5Sum", "--reconcile-report", reconcileFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeReports(); err != nil {
+		t.Fatal(err)
+	}
+	var report reconcileReport
+	readJSON(t, reconcileFile, &report)
+	want := []struct{ action, path string }{
+		{actionDownload, "org/e/lib/1/lib-1.jar"},
+		{actionDelete, "org/e/lib/1/lib-1.pom"},
+		// Lacking from b, but a failed to answer for it.
+		{actionRecheck, "org/e/lib/2/lib-2.jar"},
+	}
+	if len(report.Entries) != len(want) {
+		t.Fatalf("reconcile entries %+v, want %v", report.Entries, want)
+	}
+	for i, e := range report.Entries {
+		if e.Action != want[i].action || e.Path != filepath.FromSlash(want[i].path) {
+			t.Errorf("entry %v is %v %v, want %v %v", i, e.Action, e.Path, want[i].action, want[i].path)
+		}
+	}
+}
@@ -0,0 +1,463 @@
+package main
+
+import (
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// schemaVersion is the version of every JSON report layout and of the event
+// stream, emitted as their schemaVersion field. report.schema.json describes
+// the --json dump. It is bumped on any change that can break a consumer, such
+// as a field removed, renamed or changing type; added fields don't bump it.
+const schemaVersion = 1
+
+// missingReport is the layout of the --json dump, and of --msgpack-file.
+type missingReport struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	RunID         string `json:"runId"`
+	// StartedAt and FinishedAt follow --time-format and --timezone.
+	StartedAt  string               `json:"startedAt"`
+	FinishedAt string               `json:"finishedAt"`
+	LostDirs   []string             `json:"lostDirs"`
+	LostFiles  []string             `json:"lostFiles"`
+	ByStatus   map[string]breakdown `json:"byStatus"`
+	ByGroup    map[string]breakdown `json:"byGroup"`
+	// ByExtension counts the files checked and lost per extension.
+	ByExtension map[string]extensionCounts `json:"byExtension"`
+	// Groups maps every repository group to whether it was checked completely.
+	Groups map[string]string `json:"groups"`
+	// LostGroups nests lost checksum files under their primary artifact.
+	LostGroups []lostGroup `json:"lostGroups"`
+	// Duplicates maps files present in several repository groups to those groups.
+	Duplicates map[string][]string `json:"duplicates,omitempty"`
+	// NotChecked counts the artifacts a cancellation cut short, neither
+	// present nor lost.
+	NotChecked int `json:"notChecked"`
+	// LargestLost lists the --top-lost largest lost files.
+	LargestLost []sizedPath `json:"largestLost"`
+	// LostByRoot attributes the lost files to the --maven-repository roots
+	// they were walked in, when several are checked.
+	LostByRoot map[string][]string `json:"lostByRoot,omitempty"`
+	// RedirectChains maps artifacts to the redirect hops followed with
+	// --report-redirect-chains.
+	RedirectChains map[string][]string `json:"redirectChains,omitempty"`
+	// ServedBy counts the artifacts each fallback --nexus-root served.
+	ServedBy map[string]int `json:"servedBy,omitempty"`
+	// LocalErrors lists the local files and directories that couldn't be read,
+	// every one of them, the walk going on past them.
+	LocalErrors []localError `json:"localErrors"`
+	// Findings lists the path and detail of every finding per category, the
+	// categories --only-categories selects.
+	Findings map[string][]reportedFinding `json:"findings"`
+	// GAVs maps the coordinates of --gav or --gav-file to their outcome.
+	GAVs map[string]string `json:"gavs,omitempty"`
+	// BytesTransferred counts the body bytes read from the remotes, at
+	// ThroughputMBps over the run.
+	BytesTransferred int64   `json:"bytesTransferred"`
+	ThroughputMBps   float64 `json:"throughputMBps"`
+	// Workers is the range of workers --remote-timeout-budget let run.
+	Workers *workerRange `json:"workers,omitempty"`
+}
+
+// workerRange is the fewest and the most workers active at a time.
+type workerRange struct {
+	Min int `json:"min"`
+	Max int `json:"max"`
+}
+
+func newMissingReport() missingReport {
+	report := missingReport{schemaVersion, repo.runID, formatTime(repo.startedAt), formatTime(repo.finishedAt), repo.lostDirs, repo.lostFiles, repo.byStatus, repo.byGroup, repo.byExtension, repo.groupStatus, groupLostFiles(repo.lostFiles), repo.duplicates(), repo.notChecked, largestLost(*topLost), repo.lostByRoot, repo.redirectChains, repo.servedBy, localErrors(), reportedFindings(), nil, atomic.LoadInt64(&bytesTransferred), throughput(), nil}
+	if workerSlots != nil {
+		fewest, most := workerSlots.reached()
+		report.Workers = &workerRange{fewest, most}
+	}
+	if checkingGAVs() {
+		report.GAVs = gavStatus()
+	}
+	if !categorySelected(outcomeLost) {
+		// The counts stay, only the lists are left out of a focused report.
+		report.LostDirs, report.LostFiles, report.LostGroups, report.LargestLost, report.LostByRoot = []string{}, []string{}, []lostGroup{}, []sizedPath{}, nil
+	}
+	if !categorySelected(categoryRedirect) {
+		report.RedirectChains = nil
+	}
+	if !categorySelected(categoryLocalReadError) {
+		report.LocalErrors = []localError{}
+	}
+	return report
+}
+
+// throughput is the rate the remotes' bytes were read at over the whole run,
+// in MB/s.
+func throughput() float64 {
+	seconds := repo.finishedAt.Sub(repo.startedAt).Seconds()
+	if seconds <= 0 {
+		return 0
+	}
+	return float64(atomic.LoadInt64(&bytesTransferred)) / 1e6 / seconds
+}
+
+// reportedFinding is a Finding as the reports carry it.
+type reportedFinding struct {
+	Path   string `json:"path"`
+	Detail string `json:"detail"`
+}
+
+// reportedFindings maps every category --only-categories selects to its
+// findings, in the order they were made.
+func reportedFindings() map[string][]reportedFinding {
+	reported := map[string][]reportedFinding{}
+	for category, findings := range repo.findings {
+		if len(findings) == 0 || !categorySelected(category) {
+			continue
+		}
+		for _, f := range findings {
+			reported[category] = append(reported[category], reportedFinding{f.path, f.detail})
+		}
+	}
+	return reported
+}
+
+// localError is a local path the walk or the hashing failed to read.
+type localError struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// localErrors lists the local-read-error findings, in the order they were met.
+func localErrors() []localError {
+	errs := []localError{}
+	for _, f := range repo.findings[categoryLocalReadError] {
+		errs = append(errs, localError{f.path, f.detail})
+	}
+	return errs
+}
+
+// lostGroup is a primary artifact along with its lost checksum files. Lost
+// tells whether the primary artifact itself is lost.
+type lostGroup struct {
+	Path     string   `json:"path"`
+	Lost     bool     `json:"lost"`
+	Sidecars []string `json:"sidecars,omitempty"`
+}
+
+// groupLostFiles pairs every lost checksum sidecar with its primary artifact instead
+// of listing it as an entry of its own.
+func groupLostFiles(lostFiles []string) []lostGroup {
+	groups := []lostGroup{}
+	index := map[string]int{}
+	for _, path := range lostFiles {
+		if !isChecksumFile(path) {
+			index[path] = len(groups)
+			groups = append(groups, lostGroup{Path: path, Lost: true})
+		}
+	}
+	for _, path := range lostFiles {
+		if !isChecksumFile(path) {
+			continue
+		}
+		primary := strings.TrimSuffix(path, filepath.Ext(path))
+		i, ok := index[primary]
+		if !ok {
+			i = len(groups)
+			index[primary] = i
+			groups = append(groups, lostGroup{Path: primary})
+		}
+		groups[i].Sidecars = append(groups[i].Sidecars, path)
+	}
+	return groups
+}
+
+// sizedPath is a lost file along with its local size.
+type sizedPath struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// largestLost returns the n lost files with the largest local size, so a
+// repair can start with the most impactful ones.
+func largestLost(n int) []sizedPath {
+	lost := make([]sizedPath, 0, len(repo.lostSizes))
+	for path, size := range repo.lostSizes {
+		lost = append(lost, sizedPath{path, size})
+	}
+	sort.Slice(lost, func(i, j int) bool {
+		if lost[i].Size != lost[j].Size {
+			return lost[i].Size > lost[j].Size
+		}
+		return lost[i].Path < lost[j].Path
+	})
+	if n < 0 {
+		n = 0
+	}
+	if n < len(lost) {
+		lost = lost[:n]
+	}
+	return lost
+}
+
+// healthyReport is the JSON layout of the --healthy-out list.
+type healthyReport struct {
+	SchemaVersion int            `json:"schemaVersion"`
+	RunID         string         `json:"runId"`
+	Artifacts     []healthyEntry `json:"artifacts"`
+}
+
+// healthyEntry is a single artifact of the --healthy-out list.
+type healthyEntry struct {
+	Path string `json:"path"`
+	Code int    `json:"code"`
+}
+
+// writeReports writes every report file requested on the command line.
+func writeReports() error {
+	if *dumpJSON {
+		if err := writeJSON(*jsonFile, newMissingReport()); err != nil {
+			return err
+		}
+	}
+	if *msgpackFile != "" {
+		if err := writeMsgpack(*msgpackFile, newMissingReport()); err != nil {
+			return err
+		}
+	}
+	if *healthyOut != "" {
+		if err := writeHealthy(*healthyOut); err != nil {
+			return err
+		}
+	}
+	if *reconcileFile != "" {
+		if err := writeJSON(*reconcileFile, reconcileReport{schemaVersion, repo.runID, reconcileEntries()}); err != nil {
+			return err
+		}
+	}
+	if *artifactInventory != "" {
+		if err := writeJSON(*artifactInventory, inventoryReport{schemaVersion, repo.runID, inventory()}); err != nil {
+			return err
+		}
+	}
+	if *dedupeIdenticalFiles != "" {
+		if err := writeJSON(*dedupeIdenticalFiles, identicalReport{schemaVersion, repo.runID, identicalFiles.groups()}); err != nil {
+			return err
+		}
+	}
+	if *artifactAgeReport != "" {
+		if err := writeJSON(*artifactAgeReport, artifactAges.report(repo.startedAt)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reportFile is a report output, gzip compressed with --compress-output or a
+// .gz suffix. The compression streams, so huge reports aren't held in memory.
+type reportFile struct {
+	io.Writer
+	file *os.File
+	gz   *gzip.Writer
+}
+
+func createReport(path string) (*reportFile, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	if !*compressOutput && !strings.HasSuffix(path, ".gz") {
+		return &reportFile{Writer: file, file: file}, nil
+	}
+	gz := gzip.NewWriter(file)
+	return &reportFile{Writer: gz, file: file, gz: gz}, nil
+}
+
+// Close flushes the compression, if any, and closes the file.
+func (f *reportFile) Close() error {
+	if f.gz != nil {
+		if err := f.gz.Close(); err != nil {
+			f.file.Close()
+			return err
+		}
+	}
+	return f.file.Close()
+}
+
+func writeJSON(path string, v interface{}) error {
+	file, err := createReport(path)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func writeHealthy(path string) error {
+	entries := make([]healthyEntry, 0, len(repo.healthy))
+	for _, r := range repo.healthy {
+		entries = append(entries, healthyEntry{r.path, r.code})
+	}
+	if strings.HasSuffix(strings.TrimSuffix(path, ".gz"), ".json") {
+		return writeJSON(path, healthyReport{schemaVersion, repo.runID, entries})
+	}
+
+	file, err := createReport(path)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(file, "# run %v\n", repo.runID); err != nil {
+		file.Close()
+		return err
+	}
+	for _, entry := range entries {
+		if _, err := fmt.Fprintf(file, "%v %v\n", entry.Code, entry.Path); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	return file.Close()
+}
+
+// newRunID returns a random RFC 4122 version 4 UUID.
+func newRunID() string {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		panic(err)
+	}
+	id[6] = id[6]&0x0f | 0x40
+	id[8] = id[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:])
+}
+
+// checkedCount is the number of artifacts requested remotely.
+func checkedCount() int {
+	checked := 0
+	for _, b := range repo.byStatus {
+		checked += b.Requests
+	}
+	return checked
+}
+
+// logSummary logs the outcome of the run as counts. The full lists are only
+// logged with --verbose, otherwise they are left to the report files.
+func logSummary() {
+	if repo.preflight != "" {
+		log.Printf("Preflight: %v", repo.preflight)
+	}
+	log.Printf("Checked %v artifacts: %v present, %v lost dirs, %v lost files",
+		checkedCount(), repo.present, len(repo.lostDirs), len(repo.lostFiles))
+	if transferred := atomic.LoadInt64(&bytesTransferred); transferred > 0 {
+		log.Printf("Transferred %v bytes in %.2fs: %.2f MB/s", transferred, repo.finishedAt.Sub(repo.startedAt).Seconds(), throughput())
+	}
+	if workerSlots != nil {
+		fewest, most := workerSlots.reached()
+		log.Printf("Workers: between %v and %v active, as --remote-timeout-budget allowed", fewest, most)
+	}
+	if atomic.LoadInt32(&retryBudgetExhausted) == 1 {
+		log.Printf("Retry budget of %v exhausted, later failures were reported without retry", *retryBudget)
+	}
+	if atomic.LoadInt64(&precounted) > 0 {
+		log.Printf("Progress: %v", progress())
+	}
+	if repo.notChecked > 0 {
+		log.Printf("%v artifacts were not checked, their requests were cancelled", repo.notChecked)
+	}
+	if repo.trusted > 0 {
+		log.Printf("%v files matched --trusted-manifest and were not checked remotely", repo.trusted)
+	}
+	if repo.limitReached {
+		log.Printf("Stopped at the --limit of %v artifacts", *limit)
+	}
+	if baselineResults != nil {
+		log.Printf("Since --baseline: %v newly lost, %v newly mismatched, %v recovered", newlyLost, newlyMismatched, recovered)
+	}
+	for _, mirror := range sortedKeys(repo.servedBy) {
+		log.Printf("Mirror %v: served %v artifacts missing on %v", mirror, repo.servedBy[mirror], repo.basePathRemote)
+	}
+	if checkingGAVs() {
+		status := gavStatus()
+		present := 0
+		for _, coordinates := range sortedKeys(status) {
+			if status[coordinates] == outcomePresent {
+				present++
+			}
+			if status[coordinates] != outcomePresent || *verbose {
+				log.Printf("GAV %v: %v", coordinates, status[coordinates])
+			}
+		}
+		log.Printf("%v of %v GAVs present", present, len(status))
+	}
+	for _, root := range sortedKeys(repo.lostByRoot) {
+		log.Printf("Root %v: %v lost files", root, len(repo.lostByRoot[root]))
+	}
+	for _, lost := range largestLost(*topLost) {
+		log.Printf("Large lost file %v: %v bytes", lost.Path, lost.Size)
+	}
+	for _, category := range sortedKeys(repo.findings) {
+		log.Printf("Findings %v: %v (%v)", category, len(repo.findings[category]), severity(category))
+	}
+	for _, status := range sortedKeys(repo.byStatus) {
+		b := repo.byStatus[status]
+		log.Printf("Status %v: %v requests, %.2fs", status, b.Requests, b.Seconds)
+	}
+	for _, group := range sortedKeys(repo.byGroup) {
+		b := repo.byGroup[group]
+		log.Printf("Group %v: %v requests, %.2fs", group, b.Requests, b.Seconds)
+	}
+	for _, ext := range sortedKeys(repo.byExtension) {
+		c := repo.byExtension[ext]
+		log.Printf("Extension %v: %v checked, %v lost (%.1f%%)", ext, c.Checked, c.Lost, 100*float64(c.Lost)/float64(c.Checked))
+	}
+	for _, group := range sortedKeys(repo.groupStatus) {
+		log.Printf("Repository group %q: %v", group, repo.groupStatus[group])
+	}
+	if len(repo.redirectChains) > 0 {
+		longest := 0
+		for _, chain := range repo.redirectChains {
+			if len(chain) > longest {
+				longest = len(chain)
+			}
+		}
+		log.Printf("%v artifacts were redirected, the longest chain has %v hops", len(repo.redirectChains), longest)
+	}
+	duplicates := repo.duplicates()
+	if len(duplicates) > 0 {
+		log.Printf("%v files are present in more than one repository group", len(duplicates))
+	}
+	if *dedupeIdenticalFiles != "" {
+		log.Printf("%v sets of local files have identical content", len(identicalFiles.groups()))
+	}
+	if !*verbose {
+		return
+	}
+	for _, path := range repo.lostDirs {
+		log.Printf("Lost dir %v", path)
+	}
+	for _, path := range repo.lostFiles {
+		log.Printf("Lost file %v", path)
+	}
+	for _, path := range sortedKeys(duplicates) {
+		log.Printf("Duplicate %v in %v", path, duplicates[path])
+	}
+}
+
+// sortedKeys returns the keys of m in order, for stable output.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,449 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// readJSON decodes the JSON report file into v.
+func readJSON(t *testing.T, file string, v interface{}) {
+	t.Helper()
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(content, v); err != nil {
+		t.Fatalf("%v: %v", file, err)
+	}
+}
+
+func TestHealthyIsTheComplementOfLost(t *testing.T) {
+	local, remote, out := t.TempDir(), t.TempDir(), t.TempDir()
+	mirrorTree(t, local, remote, 5)
+	server, _ := serveTree(t, remote)
+	healthyFile, missingFile := filepath.Join(out, "healthy.json"), filepath.Join(out, "missing.json")
+	if err := runCrawler(t, "--maven-repository", local, "--nexus-root", server.URL, "--repository-name", "",
+		"--healthy-out", healthyFile, "--json", "--json-file", missingFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeReports(); err != nil {
+		t.Fatal(err)
+	}
+	var healthy healthyReport
+	readJSON(t, healthyFile, &healthy)
+	var missing missingReport
+	readJSON(t, missingFile, &missing)
+	seen := map[string]bool{}
+	for _, entry := range healthy.Artifacts {
+		seen[entry.Path] = true
+	}
+	for _, lost := range append(missing.LostDirs, missing.LostFiles...) {
+		if seen[lost] {
+			t.Errorf("%v is both healthy and lost", lost)
+		}
+		seen[lost] = true
+	}
+	// The root, org, org/e, org/e/lib and 5 versions of 2 files each.
+	if len(seen) != checkedCount() || len(seen) != 4+5*3 {
+		t.Errorf("healthy and lost cover %v artifacts, %v checked, want %v", len(seen), checkedCount(), 4+5*3)
+	}
+}
+
+func TestRunIDInEveryOutput(t *testing.T) {
+	local, remote, out := t.TempDir(), t.TempDir(), t.TempDir()
+	mirrorTree(t, local, remote, 2)
+	server, _ := serveTree(t, remote)
+	outputs := map[string]string{
+		"--json-file":          filepath.Join(out, "missing.json"),
+		"--msgpack-file":       filepath.Join(out, "missing.msgpack"),
+		"--healthy-out":        filepath.Join(out, "healthy.txt"),
+		"--reconcile-report":   filepath.Join(out, "reconcile.json"),
+		"--artifact-inventory": filepath.Join(out, "inventory.json"),
+	}
+	args := []string{"--maven-repository", local, "--nexus-root", server.URL, "--repository-name", "", "--json", "--run-id", "build-42"}
+	for name, file := range outputs {
+		args = append(args, name, file)
+	}
+	if err := runCrawler(t, args...); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeReports(); err != nil {
+		t.Fatal(err)
+	}
+	for name, file := range outputs {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Contains(content, []byte("build-42")) {
+			t.Errorf("%v output lacks the run ID", name)
+		}
+	}
+	if !strings.Contains(log.Prefix(), "build-42") {
+		t.Errorf("log prefix %q lacks the run ID", log.Prefix())
+	}
+}
+
+func TestBreakdownByStatusAndGroup(t *testing.T) {
+	local, remote, out := t.TempDir(), t.TempDir(), t.TempDir()
+	writeTree(t, local, map[string]string{
+		"org/e/lib/1.0/lib-1.0.jar": "jar content",
+		"com/f/app/1.0/app-1.0.jar": "jar content",
+	})
+	writeTree(t, remote, map[string]string{"org/e/lib/1.0/lib-1.0.jar": "jar content"})
+	server, _ := serveTree(t, remote)
+	missingFile := filepath.Join(out, "missing.json")
+	if err := runCrawler(t, "--maven-repository", local, "--nexus-root", server.URL, "--repository-name", "", "--json", "--json-file", missingFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeReports(); err != nil {
+		t.Fatal(err)
+	}
+	var missing missingReport
+	readJSON(t, missingFile, &missing)
+	for status, want := range map[string]int{"200 OK": 6, "404 Not Found": 5} {
+		if got := missing.ByStatus[status].Requests; got != want {
+			t.Errorf("%v requests = %v, want %v", status, got, want)
+		}
+	}
+	for group, want := range map[string]int{".": 1, "org": 5, "com": 5} {
+		if got := missing.ByGroup[group].Requests; got != want {
+			t.Errorf("group %v requests = %v, want %v", group, got, want)
+		}
+	}
+}
+
+func TestLostFilesDontSpamByDefault(t *testing.T) {
+	local := t.TempDir()
+	mirrorTree(t, local, t.TempDir(), 100)
+	// Only the root is served, everything below it is lost.
+	server, _ := serveTree(t, t.TempDir())
+	for _, verbose := range []bool{false, true} {
+		args := []string{"-test.run=^TestMainProcess$", "--", "--maven-repository", local, "--nexus-root", server.URL, "--repository-name", ""}
+		if verbose {
+			args = append(args, "--verbose")
+		}
+		cmd := exec.Command(os.Args[0], args...)
+		cmd.Env = append(os.Environ(), "CRAWLER_TEST_MAIN=1")
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout, cmd.Stderr = &stdout, &stderr
+		cmd.Run()
+		if stdout.Len() != 0 {
+			t.Errorf("--verbose=%v wrote to stdout:\n%v", verbose, stdout.String())
+		}
+		lost := strings.Count(stderr.String(), " is lost.")
+		if !verbose && lost != 0 {
+			t.Errorf("%v lost artifacts logged one by one without --verbose", lost)
+		}
+		if verbose && lost != 3+100*3 {
+			t.Errorf("%v lost artifacts logged with --verbose, want %v", lost, 3+100*3)
+		}
+	}
+}
+
+func TestReportFindingsFilteredByCategory(t *testing.T) {
+	local, out := t.TempDir(), t.TempDir()
+	writeTree(t, local, map[string]string{
+		"org/e/lib/1.0/lib-1.0.jar":         "jar content",
+		"org/e/lib/1.0/lib-1.0-sources.jar": "",
+		"org/e/lib/1.0/lib-1.0.pom":         "<project>",
+	})
+	missingFile := filepath.Join(out, "missing.json")
+	args := []string{"--maven-repository", local, "--local-only", "--json", "--json-file", missingFile}
+	for only, want := range map[string][]string{
+		"":          {categoryInvalidPom, categoryZeroByte},
+		"zero-byte": {categoryZeroByte},
+	} {
+		if err := runCrawler(t, append(args, "--only-categories", only)...); err != nil {
+			t.Fatal(err)
+		}
+		if err := writeReports(); err != nil {
+			t.Fatal(err)
+		}
+		var missing missingReport
+		readJSON(t, missingFile, &missing)
+		if got := sortedKeys(missing.Findings); strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("--only-categories %q reported findings %v, want %v", only, got, want)
+		}
+		if f := missing.Findings[categoryZeroByte]; len(f) != 1 || filepath.ToSlash(f[0].Path) != "org/e/lib/1.0/lib-1.0-sources.jar" || f[0].Detail == "" {
+			t.Errorf("zero-byte findings = %v", f)
+		}
+	}
+}
+
+func TestGroupLostFilesNestsSidecars(t *testing.T) {
+	groups := groupLostFiles([]string{
+		"http://nexus/ga/org/e/lib/1.0/lib-1.0.jar.md5",
+		"http://nexus/ga/org/e/lib/1.0/lib-1.0.jar",
+		"http://nexus/ga/org/e/lib/1.0/lib-1.0.jar.sha1",
+		"http://nexus/ga/org/e/lib/1.0/lib-1.0.pom.sha1",
+	})
+	want := []lostGroup{
+		{Path: "http://nexus/ga/org/e/lib/1.0/lib-1.0.jar", Lost: true, Sidecars: []string{
+			"http://nexus/ga/org/e/lib/1.0/lib-1.0.jar.md5", "http://nexus/ga/org/e/lib/1.0/lib-1.0.jar.sha1"}},
+		// The POM itself is present, only its sidecar is lost.
+		{Path: "http://nexus/ga/org/e/lib/1.0/lib-1.0.pom", Sidecars: []string{"http://nexus/ga/org/e/lib/1.0/lib-1.0.pom.sha1"}},
+	}
+	if !reflect.DeepEqual(groups, want) {
+		t.Errorf("groupLostFiles = %+v, want %+v", groups, want)
+	}
+}
+
+func TestRedirectChainsAreReported(t *testing.T) {
+	local := t.TempDir()
+	writeTree(t, local, map[string]string{
+		"org/e/lib/1.0/lib-1.0.jar": "jar content",
+		"org/e/lib/1.0/lib-1.0.pom": "<project/>",
+	})
+	elsewhere := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer elsewhere.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/org/e/lib/1.0/lib-1.0.jar":
+			http.Redirect(w, r, "/hop1/lib-1.0.jar", http.StatusFound)
+		case "/hop1/lib-1.0.jar":
+			http.Redirect(w, r, "/hop2/lib-1.0.jar", http.StatusFound)
+		case "/org/e/lib/1.0/lib-1.0.pom":
+			http.Redirect(w, r, elsewhere.URL+"/lib-1.0.pom", http.StatusFound)
+		}
+	}))
+	defer server.Close()
+	missingFile := filepath.Join(t.TempDir(), "missing.json")
+	if err := runCrawler(t, "--maven-repository", local, "--nexus-root", server.URL, "--repository-name", "",
+		"--report-redirect-chains", "--json", "--json-file", missingFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeReports(); err != nil {
+		t.Fatal(err)
+	}
+	var missing missingReport
+	readJSON(t, missingFile, &missing)
+	jar, pom := server.URL+"/org/e/lib/1.0/lib-1.0.jar", server.URL+"/org/e/lib/1.0/lib-1.0.pom"
+	want := map[string][]string{
+		jar: {server.URL + "/hop1/lib-1.0.jar", server.URL + "/hop2/lib-1.0.jar"},
+		pom: {elsewhere.URL + "/lib-1.0.pom"},
+	}
+	if !reflect.DeepEqual(missing.RedirectChains, want) {
+		t.Errorf("redirect chains = %v, want %v", missing.RedirectChains, want)
+	}
+	// Only the chain leaving the remote host is a finding.
+	if got := findingPaths(categoryRedirect); len(got) != 1 || got[0] != pom {
+		t.Errorf("redirect findings = %v, want %v", got, pom)
+	}
+}
+
+func TestBreakdownByExtension(t *testing.T) {
+	local, remote := t.TempDir(), t.TempDir()
+	files := map[string]string{
+		"org/e/lib/1.0/lib-1.0.jar":         "jar content",
+		"org/e/lib/1.0/lib-1.0.pom":         "<project/>",
+		"org/e/lib/1.0/lib-1.0.pom.md5":     md5Hex("<project/>"),
+		"org/e/lib/1.0/lib-1.0-sources.jar": "sources",
+		"org/e/lib/2.0/lib-2.0.jar":         "jar content",
+		"org/e/lib/2.0/lib-2.0.pom":         "<project/>",
+		"org/e/lib/2.0/lib-2.0-sources.jar": "sources",
+		"org/e/app/1.0/app-1.0.WAR":         "war content",
+	}
+	writeTree(t, local, files)
+	writeTree(t, remote, files)
+	for _, name := range []string{"org/e/lib/2.0/lib-2.0-sources.jar", "org/e/lib/1.0/lib-1.0.pom.md5"} {
+		if err := os.Remove(filepath.Join(remote, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	server, _ := serveTree(t, remote)
+	missingFile := filepath.Join(t.TempDir(), "missing.json")
+	if err := runCrawler(t, "--maven-repository", local, "--nexus-root", server.URL, "--repository-name", "",
+		"--json", "--json-file", missingFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeReports(); err != nil {
+		t.Fatal(err)
+	}
+	var missing missingReport
+	readJSON(t, missingFile, &missing)
+	want := map[string]extensionCounts{
+		".jar":         {Checked: 2},
+		"-sources.jar": {Checked: 2, Lost: 1},
+		".pom":         {Checked: 2},
+		".md5":         {Checked: 1, Lost: 1},
+		".war":         {Checked: 1},
+	}
+	if !reflect.DeepEqual(missing.ByExtension, want) {
+		t.Errorf("by extension = %v, want %v", missing.ByExtension, want)
+	}
+}
+
+// readGzip returns the decompressed content of a gzip report file.
+func readGzip(t *testing.T, file string) []byte {
+	t.Helper()
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("%v is not gzip: %v", file, err)
+	}
+	content, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatalf("%v: %v", file, err)
+	}
+	return content
+}
+
+func TestCompressedReports(t *testing.T) {
+	local, remote, out := t.TempDir(), t.TempDir(), t.TempDir()
+	mirrorTree(t, local, remote, 3)
+	server, _ := serveTree(t, remote)
+	args := []string{"--maven-repository", local, "--nexus-root", server.URL, "--repository-name", ""}
+	missingFile, healthyFile := filepath.Join(out, "missing.json.gz"), filepath.Join(out, "healthy.txt")
+
+	if err := runCrawler(t, append(args, "--json", "--json-file", missingFile)...); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeReports(); err != nil {
+		t.Fatal(err)
+	}
+	var missing missingReport
+	if err := json.Unmarshal(readGzip(t, missingFile), &missing); err != nil {
+		t.Fatalf("%v doesn't hold JSON: %v", missingFile, err)
+	}
+	if len(missing.LostFiles) != 2 || missing.RunID != repo.runID {
+		t.Errorf("the compressed report lists %v of run %v", missing.LostFiles, missing.RunID)
+	}
+
+	if err := runCrawler(t, append(args, "--healthy-out", healthyFile, "--compress-output")...); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeReports(); err != nil {
+		t.Fatal(err)
+	}
+	if healthy := string(readGzip(t, healthyFile)); !strings.Contains(healthy, server.URL+"/org/e/lib/1/lib-1.jar") {
+		t.Errorf("the --compress-output healthy list is %q", healthy)
+	}
+}
+
+func TestLargestLostOrderedBySize(t *testing.T) {
+	local, remote := t.TempDir(), t.TempDir()
+	writeTree(t, local, map[string]string{
+		"org/e/lib/1.0/lib-1.0.jar":         strings.Repeat("x", 5000),
+		"org/e/lib/1.0/lib-1.0-sources.jar": strings.Repeat("x", 300),
+		"org/e/lib/1.0/lib-1.0-javadoc.jar": strings.Repeat("x", 900),
+		"org/e/lib/1.0/lib-1.0.pom":         strings.Repeat("x", 300),
+		"org/e/lib/1.0/lib-1.0.war":         strings.Repeat("x", 8000),
+		"org/e/lib/1.0/lib-1.0.zip":         strings.Repeat("x", 20),
+	})
+	// The biggest file is present, it mustn't be listed.
+	writeTree(t, remote, map[string]string{"org/e/lib/1.0/lib-1.0.war": strings.Repeat("x", 8000)})
+	server, _ := serveTree(t, remote)
+	missingFile := filepath.Join(t.TempDir(), "missing.json")
+	if err := runCrawler(t, "--maven-repository", local, "--nexus-root", server.URL, "--repository-name", "",
+		"--top-lost", "4", "--json", "--json-file", missingFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeReports(); err != nil {
+		t.Fatal(err)
+	}
+	var missing missingReport
+	readJSON(t, missingFile, &missing)
+	// Ties are ordered by path.
+	base := server.URL + "/org/e/lib/1.0/"
+	want := []sizedPath{{base + "lib-1.0.jar", 5000}, {base + "lib-1.0-javadoc.jar", 900}, {base + "lib-1.0-sources.jar", 300}, {base + "lib-1.0.pom", 300}}
+	if !reflect.DeepEqual(missing.LargestLost, want) {
+		t.Errorf("largest lost = %v, want %v", missing.LargestLost, want)
+	}
+	if got := largestLost(0); len(got) != 0 {
+		t.Errorf("--top-lost 0 lists %v", got)
+	}
+}
+
+func TestBytesTransferredCountsTheSidecarsRead(t *testing.T) {
+	local, remote, out := t.TempDir(), t.TempDir(), t.TempDir()
+	files := map[string]string{}
+	sidecars := map[string]string{}
+	for _, version := range []string{"1.0", "2.0", "3.0"} {
+		jar := "org/e/lib/" + version + "/lib-" + version + ".jar"
+		files[jar] = "jar content " + version
+		sidecars[jar+".md5"] = md5Hex(files[jar]) + "\n"
+	}
+	writeTree(t, local, files)
+	writeTree(t, remote, files)
+	writeTree(t, remote, sidecars)
+	var want int64
+	for _, content := range sidecars {
+		want += int64(len(content))
+	}
+	server, _ := serveTree(t, remote)
+	missingFile := filepath.Join(out, "missing.json")
+	// Existence checks are HEAD requests, only the .md5 sidecars have a body.
+	if err := runCrawler(t, "--maven-repository", local, "--nexus-root", server.URL, "--repository-name", "",
+		"--no-preflight", "--dir-check", "none", "--md5Sum", "--json", "--json-file", missingFile); err != nil {
+		t.Fatal(err)
+	}
+	if len(findingPaths(categoryChecksumMismatch)) != 0 || len(findingPaths(categoryMissingSidecar)) != 0 {
+		t.Fatalf("sidecars not verified: %v %v", findingPaths(categoryChecksumMismatch), findingPaths(categoryMissingSidecar))
+	}
+	if err := writeReports(); err != nil {
+		t.Fatal(err)
+	}
+	var missing missingReport
+	readJSON(t, missingFile, &missing)
+	if missing.BytesTransferred != want {
+		t.Errorf("bytesTransferred = %v, want %v", missing.BytesTransferred, want)
+	}
+}
+
+func TestLocalErrorsListEveryUnreadableFile(t *testing.T) {
+	local, remote, out := t.TempDir(), t.TempDir(), t.TempDir()
+	mirrorTree(t, local, remote, 3)
+	// Dangling links can't be read even by root, unlike files without permissions.
+	for _, version := range []string{"1", "2"} {
+		jar := filepath.Join(local, "org/e/lib", version, "lib-"+version+".jar")
+		if err := os.Remove(jar); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(filepath.Join(out, "gone.jar"), jar); err != nil {
+			t.Skip("symbolic links aren't supported:", err)
+		}
+	}
+	server, _ := serveTree(t, remote)
+	missingFile := filepath.Join(out, "missing.json")
+	if err := runCrawler(t, "--maven-repository", local, "--nexus-root", server.URL, "--repository-name", "",
+		"--md5Sum", "--json", "--json-file", missingFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeReports(); err != nil {
+		t.Fatal(err)
+	}
+	var missing missingReport
+	readJSON(t, missingFile, &missing)
+	var paths []string
+	for _, e := range missing.LocalErrors {
+		paths = append(paths, filepath.ToSlash(e.Path))
+		if e.Error == "" {
+			t.Errorf("%v has no error", e.Path)
+		}
+	}
+	sort.Strings(paths)
+	if !reflect.DeepEqual(paths, []string{"org/e/lib/1/lib-1.jar", "org/e/lib/2/lib-2.jar"}) {
+		t.Errorf("localErrors = %v", missing.LocalErrors)
+	}
+	// The walk went on past them.
+	if len(missing.LostFiles) != 2 || checkedCount() != 4+3*3-2 {
+		t.Errorf("checked %v, lost %v", checkedCount(), missing.LostFiles)
+	}
+}
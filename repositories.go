@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/tabwriter"
+)
+
+// repositoriesEndpoint is the Nexus 3 REST resource listing repositories.
+const repositoriesEndpoint = "service/rest/v1/repositories"
+
+// nexusRepository is one entry of the repositories endpoint response.
+type nexusRepository struct {
+	Name   string `json:"name"`
+	Format string `json:"format"`
+	Type   string `json:"type"`
+	URL    string `json:"url"`
+}
+
+// fetchRepositories queries the Nexus REST API for the available repositories.
+func fetchRepositories(client *http.Client) ([]nexusRepository, error) {
+	url := strings.TrimRight(nexusRoots[0], "/") + "/" + repositoriesEndpoint
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to %v: %v", url, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return nil, fmt.Errorf("%v answered %v, authentication is required to list repositories", url, resp.Status)
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, fmt.Errorf("%v answered %v, the server doesn't expose the Nexus 3 REST API", url, resp.Status)
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("%v answered %v", url, resp.Status)
+	}
+
+	var repositories []nexusRepository
+	if err := json.NewDecoder(resp.Body).Decode(&repositories); err != nil {
+		return nil, fmt.Errorf("%v didn't return a repository list: %v", url, err)
+	}
+	return repositories, nil
+}
+
+// printRepositories writes the repositories as a table, one per line.
+func printRepositories(client *http.Client, out io.Writer) error {
+	repositories, err := fetchRepositories(client)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tFORMAT\tTYPE\tURL")
+	for _, r := range repositories {
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", r.Name, r.Format, r.Type, r.URL)
+	}
+	return w.Flush()
+}
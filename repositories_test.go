@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const repositoriesPayload = `[
+  {"name": "maven-releases", "format": "maven2", "type": "hosted", "url": "http://nexus/repository/maven-releases"},
+  {"name": "maven-central", "format": "maven2", "type": "proxy", "url": "http://nexus/repository/maven-central"}
+]`
+
+func TestPrintRepositories(t *testing.T) {
+	resetRun(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/"+repositoriesEndpoint {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(repositoriesPayload))
+	}))
+	defer server.Close()
+	nexusRoots = stringList{server.URL}
+	var out bytes.Buffer
+	if err := printRepositories(server.Client(), &out); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "NAME") ||
+		strings.Join(strings.Fields(lines[1]), " ") != "maven-releases maven2 hosted http://nexus/repository/maven-releases" {
+		t.Errorf("printRepositories wrote:\n%v", out.String())
+	}
+}
+
+func TestFetchRepositoriesErrors(t *testing.T) {
+	resetRun(t)
+	for code, want := range map[int]string{
+		http.StatusUnauthorized: "authentication is required",
+		http.StatusNotFound:     "doesn't expose the Nexus 3 REST API",
+		http.StatusBadGateway:   "502 Bad Gateway",
+	} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(code)
+		}))
+		nexusRoots = stringList{server.URL}
+		if _, err := fetchRepositories(server.Client()); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("status %v: error %v, want %q", code, err, want)
+		}
+		server.Close()
+	}
+}
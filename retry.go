@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// retryBackoff is the pause before the first retry, doubled for every further one.
+const retryBackoff = 500 * time.Millisecond
+
+// retriesUsed counts the retries of the whole run against --retry-budget.
+var retriesUsed int64
+
+// retryBudgetExhausted is set once a retry was refused for lack of budget.
+var retryBudgetExhausted int32
+
+// retryable tells whether a probe failed in a way worth trying again: a
+// transport error, a server side 5xx or a 429 unless --on-429 is fail.
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return *on429 != "fail"
+	}
+	return resp.StatusCode == http.StatusBadGateway || resp.StatusCode == http.StatusServiceUnavailable ||
+		resp.StatusCode == http.StatusGatewayTimeout || resp.StatusCode == http.StatusInternalServerError
+}
+
+// attemptTimeout is the --request-timeout of attempt, grown by
+// --retry-timeout-multiplier for every retry before it.
+func attemptTimeout(attempt int) time.Duration {
+	return time.Duration(float64(*requestTimeout) * math.Pow(*retryTimeoutMultiplier, float64(attempt)))
+}
+
+// doAttempt sends req as the given attempt, bounded by its attemptTimeout
+// within ctx. The response is only good for its status and headers, the body
+// can't be read once the attempt is over. With --remote-timeout-budget it
+// waits for a worker slot first and feeds its outcome back.
+func doAttempt(ctx context.Context, client *http.Client, req *http.Request, attempt int) (*http.Response, error) {
+	if !workerSlots.acquire(ctx) {
+		return nil, ctx.Err()
+	}
+	var resp *http.Response
+	var err error
+	if *requestTimeout <= 0 {
+		resp, err = client.Do(req)
+	} else {
+		attemptCtx, cancel := context.WithTimeout(ctx, attemptTimeout(attempt))
+		defer cancel()
+		resp, err = client.Do(req.WithContext(attemptCtx))
+	}
+	workerSlots.release(ctx.Err() == nil && (retryable(resp, err) || resp.StatusCode == http.StatusTooManyRequests))
+	return resp, err
+}
+
+// takeRetry claims one retry from --retry-budget, 0 being unlimited.
+func takeRetry() bool {
+	if *retryBudget <= 0 {
+		return true
+	}
+	if atomic.AddInt64(&retriesUsed, 1) > *retryBudget {
+		atomic.StoreInt32(&retryBudgetExhausted, 1)
+		return false
+	}
+	return true
+}
+
+// backoff waits before retry attempt, returning false when ctx ends first.
+func backoff(ctx context.Context, attempt int) bool {
+	timer := time.NewTimer(retryBackoff << uint(attempt))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// pause holds every worker back after a 429 with --on-429 backoff-global. A
+// rate limit is usually server wide, workers retrying on their own would just
+// trip it again.
+var pause struct {
+	mu    sync.Mutex
+	until time.Time
+}
+
+// pauseAll holds every request back for d, or longer if a pause already lasts.
+func pauseAll(d time.Duration) {
+	pause.mu.Lock()
+	defer pause.mu.Unlock()
+	if until := time.Now().Add(d); until.After(pause.until) {
+		pause.until = until
+		log.Printf("Rate limited by the remote, pausing every worker for %v", d)
+	}
+}
+
+// waitPause waits out a global pause, returning false when ctx ends first.
+func waitPause(ctx context.Context) bool {
+	pause.mu.Lock()
+	wait := time.Until(pause.until)
+	pause.mu.Unlock()
+	if wait <= 0 {
+		return true
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		// The pause may have been extended meanwhile.
+		return waitPause(ctx)
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// retryAfter reads the Retry-After of a 429, in seconds or as an HTTP date,
+// falling back to the backoff of the attempt.
+func retryAfter(resp *http.Response, attempt int) time.Duration {
+	value := resp.Header.Get("Retry-After")
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if d := time.Until(date); d > 0 {
+			return d
+		}
+	}
+	return retryBackoff << uint(attempt)
+}
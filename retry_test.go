@@ -0,0 +1,173 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryBudgetStopsRetries(t *testing.T) {
+	local, remote := t.TempDir(), t.TempDir()
+	mirrorTree(t, local, remote, 6)
+	tree := http.FileServer(http.Dir(remote))
+	var jarRequests int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".jar") {
+			atomic.AddInt64(&jarRequests, 1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		tree.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	if err := runCrawler(t, "--maven-repository", local, "--nexus-root", server.URL, "--repository-name", "",
+		"--max-retries", "2", "--retry-budget", "3"); err != nil {
+		t.Fatal(err)
+	}
+	// Every jar is tried once, only 3 retries are left for all of them.
+	if n := atomic.LoadInt64(&jarRequests); n != 6+3 {
+		t.Errorf("%v requests for the jars, want 6 and 3 retries", n)
+	}
+	if atomic.LoadInt32(&retryBudgetExhausted) != 1 {
+		t.Error("the exhausted retry budget wasn't noted")
+	}
+}
+
+func TestBackoffGlobalPausesEveryWorker(t *testing.T) {
+	local, remote := t.TempDir(), t.TempDir()
+	mirrorTree(t, local, remote, 20)
+	tree := http.FileServer(http.Dir(remote))
+	var mu sync.Mutex
+	var limitedAt time.Time
+	var during int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		if limitedAt.IsZero() && strings.HasSuffix(r.URL.Path, ".jar") {
+			limitedAt = time.Now()
+			mu.Unlock()
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		// Requests already on their way may still arrive just after the 429.
+		if since := time.Since(limitedAt); !limitedAt.IsZero() && since > 100*time.Millisecond && since < 900*time.Millisecond {
+			during++
+		}
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		tree.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	start := time.Now()
+	if err := runCrawler(t, "--maven-repository", local, "--nexus-root", server.URL, "--repository-name", "",
+		"--threads", "4", "--max-retries", "1", "--on-429", "backoff-global"); err != nil {
+		t.Fatal(err)
+	}
+	if during != 0 {
+		t.Errorf("%v requests were sent while the workers should have been paused", during)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("the run took %v, the Retry-After was 1s", elapsed)
+	}
+	// The rate limited jar was retried after the pause and found.
+	if checkedCount() != 4+20*3 || len(repo.lostDirs) != 1 || len(repo.lostFiles) != 2 {
+		t.Errorf("%v checked, lost %v %v", checkedCount(), repo.lostDirs, repo.lostFiles)
+	}
+}
+
+func TestBackoffGlobalRetriesWithoutMaxRetries(t *testing.T) {
+	local, remote := t.TempDir(), t.TempDir()
+	files := map[string]string{"org/e/lib/1.0/lib-1.0.jar": "jar content"}
+	writeTree(t, local, files)
+	writeTree(t, remote, files)
+	tree := http.FileServer(http.Dir(remote))
+	var jarRequests int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".jar") && atomic.AddInt64(&jarRequests, 1) == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		tree.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	if err := runCrawler(t, "--maven-repository", local, "--nexus-root", server.URL, "--repository-name", "",
+		"--threads", "1", "--on-429", "backoff-global"); err != nil {
+		t.Fatal(err)
+	}
+	// The default --max-retries 0 still retries the jar once after the pause.
+	if n := atomic.LoadInt64(&jarRequests); n != 2 {
+		t.Errorf("%v requests for the jar, want the 429 and its retry", n)
+	}
+	if len(repo.lostFiles) != 0 {
+		t.Errorf("the rate limited jar is lost: %v", repo.lostFiles)
+	}
+}
+
+func TestOn429FailStopsTheRun(t *testing.T) {
+	local, remote := t.TempDir(), t.TempDir()
+	mirrorTree(t, local, remote, 3)
+	tree := http.FileServer(http.Dir(remote))
+	var jarRequests int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".jar") {
+			atomic.AddInt64(&jarRequests, 1)
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		tree.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	err := runCrawler(t, "--maven-repository", local, "--nexus-root", server.URL, "--repository-name", "",
+		"--threads", "1", "--max-retries", "3", "--on-429", "fail")
+	if err == nil || !strings.Contains(err.Error(), "--on-429 fail") {
+		t.Errorf("error %v, want the run stopped by --on-429 fail", err)
+	}
+	// Neither retried nor carried on with the other jars.
+	if n := atomic.LoadInt64(&jarRequests); n != 1 {
+		t.Errorf("%v requests for the jars, want 1", n)
+	}
+}
+
+func TestRetriesGetLongerTimeouts(t *testing.T) {
+	resetRun(t)
+	*requestTimeout, *retryTimeoutMultiplier = time.Second, 2
+	for attempt, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		if got := attemptTimeout(attempt); got != want {
+			t.Errorf("attempt %v times out after %v, want %v", attempt, got, want)
+		}
+	}
+
+	local := t.TempDir()
+	writeTree(t, local, map[string]string{"org/e/lib/1.0/lib-1.0.jar": "jar content"})
+	var mu sync.Mutex
+	var attempts []time.Duration
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, ".jar") {
+			return
+		}
+		// The remote hangs until the client gives up on the attempt.
+		start := time.Now()
+		<-r.Context().Done()
+		mu.Lock()
+		attempts = append(attempts, time.Since(start))
+		mu.Unlock()
+	}))
+	defer server.Close()
+	err := runCrawler(t, "--maven-repository", local, "--nexus-root", server.URL, "--repository-name", "", "--no-preflight",
+		"--request-timeout", "100ms", "--retry-timeout-multiplier", "3", "--max-retries", "1")
+	if !isTimeout(err) {
+		t.Errorf("run ended with %v, want the jar timing out", err)
+	}
+	// Closing waits for the handler noting the last attempt.
+	server.Close()
+	mu.Lock()
+	defer mu.Unlock()
+	if len(attempts) != 2 || attempts[0] > 250*time.Millisecond || attempts[1] < 250*time.Millisecond {
+		t.Errorf("attempts lasted %v, want about 100ms then 300ms", attempts)
+	}
+}
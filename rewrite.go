@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// backReference matches a sed style \1 in a replacement.
+var backReference = regexp.MustCompile(`\\(\d)`)
+
+// rewriteRule is one s/pattern/replacement/ of --path-rewrite.
+type rewriteRule struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// rewriteRules holds the repeatable --path-rewrite flag, applied in the order given.
+type rewriteRules []rewriteRule
+
+var pathRewrites rewriteRules
+
+func (r *rewriteRules) String() string {
+	rules := make([]string, len(*r))
+	for i, rule := range *r {
+		rules[i] = "s/" + rule.pattern.String() + "/" + rule.replacement + "/"
+	}
+	return strings.Join(rules, " ")
+}
+
+// Set compiles a sed style s/pattern/replacement/ rule. Any character after
+// the s is the delimiter, and both \1 and ${1} refer to capture groups.
+func (r *rewriteRules) Set(value string) error {
+	if len(value) < 4 || value[0] != 's' {
+		return fmt.Errorf("%q is not s/pattern/replacement/", value)
+	}
+	delimiter := value[1:2]
+	parts := strings.Split(value[2:], delimiter)
+	if len(parts) != 3 || parts[2] != "" {
+		return fmt.Errorf("%q is not s%vpattern%vreplacement%v", value, delimiter, delimiter, delimiter)
+	}
+	pattern, err := regexp.Compile(parts[0])
+	if err != nil {
+		return fmt.Errorf("%q: %v", value, err)
+	}
+	*r = append(*r, rewriteRule{pattern, backReference.ReplaceAllString(parts[1], "$${$1}")})
+	return nil
+}
+
+// apply rewrites a local relative path into the path the remote stores it under.
+func (r rewriteRules) apply(relPath string) string {
+	rewritten := filepath.ToSlash(relPath)
+	for _, rule := range r {
+		rewritten = rule.pattern.ReplaceAllString(rewritten, rule.replacement)
+	}
+	return rewritten
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestPathRewriteRules(t *testing.T) {
+	var rules rewriteRules
+	for _, rule := range []string{
+		`s#^org/e/#release/org/e/#`,
+		`s|/([^/]+)/([0-9.]+)/|/\1/v${2}/|`,
+		`s#-sources\.jar$#-src.jar#`,
+	} {
+		if err := rules.Set(rule); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for relPath, want := range map[string]string{
+		"org/e/lib/1.0/lib-1.0.jar":         "release/org/e/lib/v1.0/lib-1.0.jar",
+		"org/e/lib/1.0/lib-1.0-sources.jar": "release/org/e/lib/v1.0/lib-1.0-src.jar",
+		"com/x/app/2.1/app-2.1.pom":         "com/x/app/v2.1/app-2.1.pom",
+		"com/x/app":                         "com/x/app",
+	} {
+		if got := rules.apply(filepath.FromSlash(relPath)); got != want {
+			t.Errorf("apply(%q) = %q, want %q", relPath, got, want)
+		}
+	}
+	for _, rule := range []string{"release/", "s/a/b", "s/a/b/c", "s/(/b/", "x/a/b/"} {
+		if err := (&rewriteRules{}).Set(rule); err == nil {
+			t.Errorf("Set(%q) accepted an invalid rule", rule)
+		}
+	}
+}
+
+func TestPathRewriteMapsTheRemoteLayout(t *testing.T) {
+	local, remote := t.TempDir(), t.TempDir()
+	writeTree(t, local, map[string]string{
+		"org/e/lib/1.0/lib-1.0.jar": "jar content",
+		"org/e/lib/1.0/lib-1.0.pom": "<project/>",
+	})
+	writeTree(t, remote, map[string]string{
+		"release/org/e/lib/1.0/lib-1.0.jar": "jar content",
+		"release/org/e/lib/1.0/lib-1.0.pom": "<project/>",
+	})
+	server, _ := serveTree(t, remote)
+	if err := runCrawler(t, "--maven-repository", local, "--nexus-root", server.URL, "--repository-name", "",
+		"--path-rewrite", `s#^(org)(/|$)#release/\1\2#`); err != nil {
+		t.Fatal(err)
+	}
+	// The root isn't rewritten, it's present at the top of the tree anyway.
+	if len(repo.lostDirs) != 0 || len(repo.lostFiles) != 0 || repo.present != checkedCount() {
+		t.Errorf("lost %v and %v, %v of %v present", repo.lostDirs, repo.lostFiles, repo.present, checkedCount())
+	}
+}
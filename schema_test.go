@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// validateSchema checks value against the subset of JSON Schema that
+// report.schema.json uses: type, const, required, properties,
+// additionalProperties, items and local $refs.
+func validateSchema(root map[string]interface{}, schema map[string]interface{}, value interface{}, at string) []string {
+	if ref, ok := schema["$ref"].(string); ok {
+		def := root
+		for _, key := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+			def = def[key].(map[string]interface{})
+		}
+		return validateSchema(root, def, value, at)
+	}
+	if want, ok := schema["const"]; ok && !reflect.DeepEqual(value, want) {
+		return []string{fmt.Sprintf("%v is %v, want %v", at, value, want)}
+	}
+	var problems []string
+	switch schema["type"] {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%v is %#v, want an object", at, value)}
+		}
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, key := range required {
+				if _, ok := object[key.(string)]; !ok {
+					problems = append(problems, fmt.Sprintf("%v lacks %v", at, key))
+				}
+			}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		for key, v := range object {
+			if property, ok := properties[key].(map[string]interface{}); ok {
+				problems = append(problems, validateSchema(root, property, v, at+"."+key)...)
+			} else if additional, ok := schema["additionalProperties"].(map[string]interface{}); ok {
+				problems = append(problems, validateSchema(root, additional, v, at+"."+key)...)
+			} else if properties != nil {
+				problems = append(problems, fmt.Sprintf("%v.%v isn't in the schema", at, key))
+			}
+		}
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%v is %#v, want an array", at, value)}
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, v := range array {
+				problems = append(problems, validateSchema(root, items, v, fmt.Sprintf("%v[%v]", at, i))...)
+			}
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			problems = append(problems, fmt.Sprintf("%v is %#v, want a string", at, value))
+		}
+	case "integer":
+		if n, ok := value.(float64); !ok || n != float64(int64(n)) {
+			problems = append(problems, fmt.Sprintf("%v is %#v, want an integer", at, value))
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			problems = append(problems, fmt.Sprintf("%v is %#v, want a number", at, value))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			problems = append(problems, fmt.Sprintf("%v is %#v, want a boolean", at, value))
+		}
+	}
+	return problems
+}
+
+func TestJSONReportMatchesTheSchema(t *testing.T) {
+	var schema map[string]interface{}
+	readJSON(t, "report.schema.json", &schema)
+	local, remote, out := t.TempDir(), t.TempDir(), t.TempDir()
+	mirrorTree(t, local, remote, 3)
+	writeTree(t, local, map[string]string{"org/e/lib/1/lib-1.jar.md5": md5Hex("older content")})
+	writeTree(t, remote, map[string]string{"org/e/lib/1/lib-1.jar.md5": md5Hex("older content")})
+	server, _ := serveTree(t, remote)
+	missingFile := filepath.Join(out, "missing.json")
+	if err := runCrawler(t, "--maven-repository", local, "--nexus-root", server.URL, "--repository-name", "",
+		"--md5Sum", "--json", "--json-file", missingFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeReports(); err != nil {
+		t.Fatal(err)
+	}
+	var report map[string]interface{}
+	readJSON(t, missingFile, &report)
+	if report["schemaVersion"] != float64(schemaVersion) {
+		t.Errorf("schemaVersion = %v, want %v", report["schemaVersion"], schemaVersion)
+	}
+	if len(report["lostFiles"].([]interface{})) == 0 || len(report["findings"].(map[string]interface{})) == 0 {
+		t.Fatalf("the fixture should lose files and find a checksum mismatch: %v", report)
+	}
+	for _, problem := range validateSchema(schema, schema, report, "report") {
+		t.Error(problem)
+	}
+}
+
+func TestSchemaDescribesEveryReportField(t *testing.T) {
+	var schema struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+		Required   []string                   `json:"required"`
+	}
+	content, err := os.ReadFile("report.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(content, &schema); err != nil {
+		t.Fatal(err)
+	}
+	required := map[string]bool{}
+	for _, name := range schema.Required {
+		required[name] = true
+	}
+	fields := reflect.TypeOf(missingReport{})
+	for i := 0; i < fields.NumField(); i++ {
+		tag := strings.Split(fields.Field(i).Tag.Get("json"), ",")
+		if _, ok := schema.Properties[tag[0]]; !ok {
+			t.Errorf("%v isn't in report.schema.json", tag[0])
+		}
+		// Fields left out when empty can't be required.
+		if omitted := len(tag) > 1 && tag[1] == "omitempty"; omitted == required[tag[0]] {
+			t.Errorf("%v: omitempty %v, required %v", tag[0], omitted, required[tag[0]])
+		}
+	}
+}
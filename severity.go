@@ -0,0 +1,61 @@
+package main
+
+// Finding severities. Failures make the run exit with exitFindings, warnings
+// are only reported. Lost files and directories and artifacts left unchecked
+// fail the run the same way.
+const (
+	severityWarning = "warning"
+	severityFailure = "failure"
+)
+
+// exitFindings is the exit status of a run that completed with failures.
+const exitFindings = 2
+
+// categorySeverity is the single severity table. --strict upgrades every
+// warning in it to a failure.
+var categorySeverity = map[string]string{
+	categoryChecksumMismatch: severityFailure,
+	categoryZeroByte:         severityFailure,
+	categoryInvalidPom:       severityFailure,
+	categoryMirrorMismatch:   severityFailure,
+	categoryLocalReadError:   severityFailure,
+	categoryTypeMismatch:     severityFailure,
+	categoryMetadataVersion:  severityFailure,
+	categoryHTMLPage:         severityFailure,
+	categoryOrphanChecksum:   severityFailure,
+	categoryLocalChecksum:    severityFailure,
+	categorySizeMismatch:     severityFailure,
+	categoryMissingSidecar:   severityWarning,
+	categoryContentType:      severityWarning,
+	categoryRedirect:         severityWarning,
+	categoryForbidden:        severityWarning,
+	categoryEmptyDir:         severityWarning,
+	categoryNonCanonicalPath: severityWarning,
+	categoryDownloadMarker:   severityWarning,
+	categoryCertExpiry:       severityWarning,
+}
+
+// severity returns the severity of category under the current --strict setting.
+func severity(category string) string {
+	if *strict {
+		return severityFailure
+	}
+	if s, ok := categorySeverity[category]; ok {
+		return s
+	}
+	return severityWarning
+}
+
+// hasFailures tells whether the run failed its check: something is lost, an
+// artifact wasn't checked or a finding is a failure.
+func hasFailures() bool {
+	if len(repo.lostDirs) > 0 || len(repo.lostFiles) > 0 || repo.notChecked > 0 {
+		return true
+	}
+	for category, findings := range repo.findings {
+		if len(findings) > 0 && severity(category) == severityFailure {
+			return true
+		}
+	}
+	return false
+}
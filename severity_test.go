@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStrictFailsOnWarnings(t *testing.T) {
+	local := t.TempDir()
+	writeTree(t, local, map[string]string{"org/e/lib/1.0/lib-1.0.jar": "jar content"})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".jar") {
+			w.Header().Set("Content-Type", "text/plain")
+			return
+		}
+		// The directories are listings.
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	}))
+	defer server.Close()
+	args := []string{"--maven-repository", local, "--nexus-root", server.URL, "--repository-name", "", "--verify-content-type-map"}
+	if code, output := runMain(t, args...); code != 0 {
+		t.Errorf("a content-type-mismatch warning exited with %v, output %q", code, output)
+	}
+	if code, output := runMain(t, append(args, "--strict")...); code != exitFindings {
+		t.Errorf("with --strict, a content-type-mismatch exited with %v, want %v, output %q", code, exitFindings, output)
+	}
+}
+
+func TestLostFileFailsTheRun(t *testing.T) {
+	local := t.TempDir()
+	writeTree(t, local, map[string]string{"org/e/lib/1.0/lib-1.0.jar": "jar content"})
+	server, _ := serveTree(t, t.TempDir())
+	code, output := runMain(t, "--maven-repository", local, "--nexus-root", server.URL, "--repository-name", "")
+	if code != exitFindings {
+		t.Errorf("a lost file exited with %v, want %v, output %q", code, exitFindings, output)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// maxMetadataSize bounds the remote maven-metadata.xml read to resolve snapshots.
+const maxMetadataSize = 1 << 20
+
+// snapshotVersion maps a classifier and extension to the timestamped version
+// the remote deployed last, e.g. 1.0-20240101.120000-3.
+type snapshotVersion struct {
+	Classifier string `xml:"classifier"`
+	Extension  string `xml:"extension"`
+	Value      string `xml:"value"`
+}
+
+// snapshotLookup is the remote metadata of one SNAPSHOT version directory,
+// fetched once however many workers ask for it.
+type snapshotLookup struct {
+	once     sync.Once
+	versions map[string]string
+	err      error
+}
+
+// snapshotResolver translates the -SNAPSHOT file names of the local tree to the
+// timestamped names listed in the remote maven-metadata.xml.
+type snapshotResolver struct {
+	mu      sync.Mutex
+	lookups map[string]*snapshotLookup
+}
+
+var snapshots = snapshotResolver{lookups: map[string]*snapshotLookup{}}
+
+// resolve returns the remote URL of the timestamped file relPath stands for,
+// or url unchanged when relPath isn't a SNAPSHOT file or the remote metadata
+// doesn't list it.
+func (s *snapshotResolver) resolve(ctx context.Context, client *http.Client, base string, group string, relPath string, url string) string {
+	relPath = filepath.ToSlash(relPath)
+	versionDir := path.Dir(relPath)
+	version := path.Base(versionDir)
+	artifactID := path.Base(path.Dir(versionDir))
+	name := path.Base(relPath)
+	prefix := artifactID + "-" + version
+	if !strings.HasSuffix(version, "-SNAPSHOT") || !strings.HasPrefix(name, prefix) {
+		return url
+	}
+	rest := strings.TrimPrefix(name, prefix)
+	sidecarExt := ""
+	if isChecksumFile(rest) {
+		sidecarExt = path.Ext(rest)
+		rest = strings.TrimSuffix(rest, sidecarExt)
+	}
+	classifier := ""
+	if strings.HasPrefix(rest, "-") {
+		dot := strings.Index(rest, ".")
+		if dot < 0 {
+			return url
+		}
+		classifier, rest = rest[1:dot], rest[dot:]
+	}
+	if !strings.HasPrefix(rest, ".") {
+		return url
+	}
+	extension := rest[1:]
+
+	versions, err := s.versions(ctx, client, remoteURL(base, group, path.Join(versionDir, metadataFileName)))
+	if err != nil {
+		return url
+	}
+	value, ok := versions[classifier+":"+extension]
+	if !ok {
+		return url
+	}
+	resolved := artifactID + "-" + value
+	if classifier != "" {
+		resolved += "-" + classifier
+	}
+	resolved += "." + extension + sidecarExt
+	return remoteURL(base, group, path.Join(versionDir, resolved))
+}
+
+// versions returns the snapshotVersions of the metadata at metadataURL keyed by
+// classifier:extension, fetching it on first use.
+func (s *snapshotResolver) versions(ctx context.Context, client *http.Client, metadataURL string) (map[string]string, error) {
+	s.mu.Lock()
+	lookup, ok := s.lookups[metadataURL]
+	if !ok {
+		lookup = &snapshotLookup{}
+		s.lookups[metadataURL] = lookup
+	}
+	s.mu.Unlock()
+	lookup.once.Do(func() {
+		lookup.versions, lookup.err = fetchSnapshotVersions(ctx, client, metadataURL)
+	})
+	return lookup.versions, lookup.err
+}
+
+func fetchSnapshotVersions(ctx context.Context, client *http.Client, metadataURL string) (map[string]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, metadataURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%v answered %v", metadataURL, resp.Status)
+	}
+	content, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxMetadataSize))
+	if err != nil {
+		return nil, err
+	}
+	return parseSnapshotVersions(content)
+}
+
+// parseSnapshotVersions reads the snapshotVersions of a SNAPSHOT version level
+// maven-metadata.xml, keyed by classifier:extension.
+func parseSnapshotVersions(content []byte) (map[string]string, error) {
+	var metadata mavenMetadata
+	if err := xml.Unmarshal(content, &metadata); err != nil {
+		return nil, err
+	}
+	versions := map[string]string{}
+	for _, v := range metadata.Versioning.SnapshotVersions {
+		versions[v.Classifier+":"+v.Extension] = v.Value
+	}
+	return versions, nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import "testing"
+
+const snapshotMetadata = `<?xml version="1.0" encoding="UTF-8"?>
+<metadata>
+  <groupId>org.e</groupId>
+  <artifactId>lib</artifactId>
+  <version>1.0-SNAPSHOT</version>
+  <versioning>
+    <snapshot>
+      <timestamp>20240101.120000</timestamp>
+      <buildNumber>3</buildNumber>
+    </snapshot>
+    <snapshotVersions>
+      <snapshotVersion>
+        <extension>jar</extension>
+        <value>1.0-20240101.120000-3</value>
+      </snapshotVersion>
+      <snapshotVersion>
+        <classifier>sources</classifier>
+        <extension>jar</extension>
+        <value>1.0-20240101.120000-3</value>
+      </snapshotVersion>
+      <snapshotVersion>
+        <extension>pom</extension>
+        <value>1.0-20240101.115500-2</value>
+      </snapshotVersion>
+    </snapshotVersions>
+  </versioning>
+</metadata>`
+
+func TestParseSnapshotVersions(t *testing.T) {
+	versions, err := parseSnapshotVersions([]byte(snapshotMetadata))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		":jar":        "1.0-20240101.120000-3",
+		"sources:jar": "1.0-20240101.120000-3",
+		":pom":        "1.0-20240101.115500-2",
+	}
+	if len(versions) != len(want) {
+		t.Errorf("parseSnapshotVersions = %v, want %v", versions, want)
+	}
+	for key, value := range want {
+		if versions[key] != value {
+			t.Errorf("%v resolves to %q, want %q", key, versions[key], value)
+		}
+	}
+	if _, err := parseSnapshotVersions([]byte("<metadata>")); err == nil {
+		t.Error("truncated metadata parsed")
+	}
+}
+
+func TestResolveSnapshotsChecksTimestampedFiles(t *testing.T) {
+	local, remote := t.TempDir(), t.TempDir()
+	writeTree(t, local, map[string]string{
+		"org/e/lib/1.0-SNAPSHOT/lib-1.0-SNAPSHOT.jar":         "jar content",
+		"org/e/lib/1.0-SNAPSHOT/lib-1.0-SNAPSHOT-sources.jar": "sources",
+		"org/e/lib/1.0-SNAPSHOT/lib-1.0-SNAPSHOT.pom":         "<project/>",
+		"org/e/lib/1.0-SNAPSHOT/lib-1.0-SNAPSHOT.jar.sha1":    sha1Hex("jar content"),
+		"org/e/lib/1.0-SNAPSHOT/lib-1.0-SNAPSHOT-javadoc.jar": "javadoc",
+	})
+	writeTree(t, remote, map[string]string{
+		"org/e/lib/1.0-SNAPSHOT/maven-metadata.xml":                    snapshotMetadata,
+		"org/e/lib/1.0-SNAPSHOT/lib-1.0-20240101.120000-3.jar":         "jar content",
+		"org/e/lib/1.0-SNAPSHOT/lib-1.0-20240101.120000-3.jar.sha1":    sha1Hex("jar content"),
+		"org/e/lib/1.0-SNAPSHOT/lib-1.0-20240101.120000-3-sources.jar": "sources",
+		"org/e/lib/1.0-SNAPSHOT/lib-1.0-20240101.115500-2.pom":         "<project/>",
+	})
+	server, _ := serveTree(t, remote)
+	args := []string{"--maven-repository", local, "--nexus-root", server.URL, "--repository-name", ""}
+
+	if err := runCrawler(t, args...); err != nil {
+		t.Fatal(err)
+	}
+	if len(repo.lostFiles) != 5 {
+		t.Errorf("without --resolve-snapshots lost %v, want every file", repo.lostFiles)
+	}
+
+	if err := runCrawler(t, append(args, "--resolve-snapshots")...); err != nil {
+		t.Fatal(err)
+	}
+	// The metadata doesn't list a javadoc jar, so it keeps its -SNAPSHOT name.
+	want := server.URL + "/org/e/lib/1.0-SNAPSHOT/lib-1.0-SNAPSHOT-javadoc.jar"
+	if len(repo.lostFiles) != 1 || repo.lostFiles[0] != want {
+		t.Errorf("with --resolve-snapshots lost %v, want only %v", repo.lostFiles, want)
+	}
+}
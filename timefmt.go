@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"time"
+)
+
+// outputLocation is the --timezone every emitted timestamp is expressed in.
+var outputLocation = time.Local
+
+// parseTimeFlags validates --time-format and loads --timezone.
+func parseTimeFlags() error {
+	if *timeFormat != "rfc3339" && *timeFormat != "unix" {
+		return fmt.Errorf("--time-format must be rfc3339 or unix, got %v", *timeFormat)
+	}
+	if *timezone != "" {
+		location, err := time.LoadLocation(*timezone)
+		if err != nil {
+			return fmt.Errorf("--timezone %v: %v", *timezone, err)
+		}
+		outputLocation = location
+	}
+	return nil
+}
+
+// formatTime renders t as --time-format in --timezone: RFC 3339 or Unix seconds.
+func formatTime(t time.Time) string {
+	if *timeFormat == "unix" {
+		return strconv.FormatInt(t.Unix(), 10)
+	}
+	return t.In(outputLocation).Format(time.RFC3339)
+}
+
+// timestampWriter stamps every log line with formatTime, after the run ID
+// prefix, in place of the log package's own date and time.
+type timestampWriter struct {
+	out io.Writer
+}
+
+func (w timestampWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	prefix := []byte(log.Prefix())
+	line := make([]byte, 0, len(p)+32)
+	if bytes.HasPrefix(p, prefix) {
+		line = append(line, prefix...)
+		p = p[len(prefix):]
+	}
+	line = append(line, formatTime(time.Now())...)
+	line = append(line, ' ')
+	line = append(line, p...)
+	if _, err := w.out.Write(line); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
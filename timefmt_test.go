@@ -0,0 +1,59 @@
+package main
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatTime(t *testing.T) {
+	instant := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	for _, test := range []struct {
+		format, zone, want string
+	}{
+		{"rfc3339", "UTC", "2024-03-01T12:30:00Z"},
+		{"rfc3339", "Europe/Berlin", "2024-03-01T13:30:00+01:00"},
+		{"unix", "UTC", "1709296200"},
+		{"unix", "Europe/Berlin", "1709296200"},
+	} {
+		resetRun(t)
+		*timeFormat, *timezone = test.format, test.zone
+		if err := parseTimeFlags(); err != nil {
+			t.Skipf("no time zone database: %v", err)
+		}
+		if got := formatTime(instant); got != test.want {
+			t.Errorf("--time-format %v --timezone %v formats %v as %v, want %v", test.format, test.zone, instant, got, test.want)
+		}
+	}
+
+	resetRun(t)
+	*timeFormat = "iso"
+	if err := parseTimeFlags(); err == nil {
+		t.Error("--time-format iso was accepted")
+	}
+	resetRun(t)
+	*timezone = "Mars/Olympus_Mons"
+	if err := parseTimeFlags(); err == nil {
+		t.Error("an unknown --timezone was accepted")
+	}
+}
+
+func TestTimestampWriterKeepsPrefixFirst(t *testing.T) {
+	resetRun(t)
+	*timeFormat = "unix"
+	log.SetPrefix("[run-1] ")
+	var out strings.Builder
+	before := time.Now().Unix()
+	if _, err := (timestampWriter{&out}).Write([]byte("[run-1] Scan started\n")); err != nil {
+		t.Fatal(err)
+	}
+	fields := strings.Fields(out.String())
+	if len(fields) != 4 || fields[0] != "[run-1]" || fields[2] != "Scan" {
+		t.Fatalf("stamped line %q, want the run ID, the time and the message", out.String())
+	}
+	if stamp, err := strconv.ParseInt(fields[1], 10, 64); err != nil || stamp < before || stamp > time.Now().Unix() {
+		t.Errorf("stamped with %v, want the Unix time of the write", fields[1])
+	}
+}
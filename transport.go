@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var clientCertificates []tls.Certificate
+
+// loadClientCertificate loads the --client-cert/--client-key pair used for
+// mutual TLS. tls.LoadX509KeyPair rejects a key that doesn't match the certificate.
+func loadClientCertificate() error {
+	if *clientCert == "" && *clientKey == "" {
+		return nil
+	}
+	if *clientCert == "" || *clientKey == "" {
+		return errors.New("--client-cert and --client-key must be provided together")
+	}
+	certificate, err := tls.LoadX509KeyPair(*clientCert, *clientKey)
+	if err != nil {
+		return fmt.Errorf("Cannot load client certificate: %v", err)
+	}
+	clientCertificates = []tls.Certificate{certificate}
+	return nil
+}
+
+// validateProxy checks --proxy and the --proxy-user/--proxy-password pair.
+func validateProxy() error {
+	if *proxy != "" {
+		u, err := url.Parse(*proxy)
+		if err != nil || u.Host == "" {
+			return fmt.Errorf("--proxy %v is not a proxy URL such as http://proxy:3128", *proxy)
+		}
+	}
+	if *proxyPassword != "" && *proxyUser == "" {
+		return errors.New("--proxy-password requires --proxy-user")
+	}
+	if strings.Contains(*proxyUser, ":") {
+		return errors.New("--proxy-user must not contain a colon")
+	}
+	return nil
+}
+
+// proxyURL picks --proxy or the HTTP(S)_PROXY environment and adds the
+// --proxy-user credentials, which net/http sends as Proxy-Authorization on
+// plain requests and on the CONNECT tunnel for https.
+func proxyURL(req *http.Request) (*url.URL, error) {
+	var proxyURL *url.URL
+	if *proxy != "" {
+		u, err := url.Parse(*proxy)
+		if err != nil {
+			return nil, err
+		}
+		proxyURL = u
+	} else {
+		u, err := http.ProxyFromEnvironment(req)
+		if err != nil || u == nil {
+			return u, err
+		}
+		proxyURL = u
+	}
+	if *proxyUser != "" {
+		withUser := *proxyURL
+		withUser.User = url.UserPassword(*proxyUser, *proxyPassword)
+		proxyURL = &withUser
+	}
+	return proxyURL, nil
+}
+
+// newHTTPClient builds the client shared by all workers. With --http2 the
+// transport offers h2 via ALPN so HEADs are multiplexed over few connections.
+func newHTTPClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   *dialTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+	tr := &http.Transport{
+		Proxy:               proxyURL,
+		DialContext:         pinnedDialer(dialer),
+		TLSHandshakeTimeout: *tlsHandshakeTimeout,
+		MaxIdleConns:        10,
+		MaxIdleConnsPerHost: *threads,
+		IdleConnTimeout:     30 * time.Second,
+		DisableCompression:  true,
+		ForceAttemptHTTP2:   *http2,
+	}
+	// A file:// remote is a local directory, typically a staged mirror or a
+	// downloaded cache, served the way a plain HTTP file server would.
+	tr.RegisterProtocol("file", http.NewFileTransport(http.Dir("/")))
+	if len(clientCertificates) > 0 {
+		tr.TLSClientConfig = &tls.Config{Certificates: clientCertificates}
+	}
+	var base http.RoundTripper = tr
+	if *dumpRequests {
+		// Innermost, so the dump shows the requests as sent, with the headers
+		// the other transports add.
+		base = dumpTransport{tr}
+	}
+	client := &http.Client{
+		Transport: countingTransport{base},
+	}
+	if *noCache {
+		client.Transport = noCacheTransport{client.Transport}
+	}
+	if *canonicalizeRedirects {
+		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	} else {
+		client.CheckRedirect = followRedirect
+	}
+	if len(allowedHostSet) > 0 {
+		client.Transport = allowedHostsTransport{client.Transport}
+	}
+	return client
+}
+
+// maxRedirects is the limit net/http applies to followed redirects by default.
+const maxRedirects = 10
+
+type redirectChainKey struct{}
+
+// withRedirectChain returns a context whose requests record every redirect hop
+// they follow, for redirectChain to read back.
+func withRedirectChain(ctx context.Context) context.Context {
+	return context.WithValue(ctx, redirectChainKey{}, &[]string{})
+}
+
+// redirectChain returns the hops recorded for a request made with a context
+// from withRedirectChain; resp.Request carries it along every hop.
+func redirectChain(ctx context.Context) []string {
+	if chain, ok := ctx.Value(redirectChainKey{}).(*[]string); ok {
+		return *chain
+	}
+	return nil
+}
+
+// followRedirect is the CheckRedirect of the client unless redirects are
+// canonicalized. It keeps the default limit of followed redirects, refuses hops
+// to hosts off --allowed-hosts and records the chain for --report-redirect-chains.
+func followRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	if !hostAllowed(req.URL) {
+		return fmt.Errorf("%v redirects to %v, host %v is not in --allowed-hosts", via[0].URL, req.URL, req.URL.Host)
+	}
+	if chain, ok := req.Context().Value(redirectChainKey{}).(*[]string); ok {
+		*chain = append(*chain, req.URL.String())
+	}
+	return nil
+}
+
+// allowedHostSet holds the --allowed-hosts entries, empty to allow any host.
+var allowedHostSet = map[string]bool{}
+
+// parseAllowedHosts reads --allowed-hosts and makes sure the configured
+// remotes are on it, so a typo fails before the crawl instead of on every request.
+func parseAllowedHosts() error {
+	for _, host := range strings.Split(*allowedHosts, ",") {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			allowedHostSet[host] = true
+		}
+	}
+	if len(allowedHostSet) == 0 {
+		return nil
+	}
+	for _, remote := range append(nexusRoots[:len(nexusRoots):len(nexusRoots)], *compareRemote) {
+		if remote == "" {
+			continue
+		}
+		if u, err := url.Parse(remote); err != nil || !hostAllowed(u) {
+			return fmt.Errorf("%v is not in --allowed-hosts", remote)
+		}
+	}
+	return nil
+}
+
+// hostAllowed matches u against --allowed-hosts by host:port or by host name alone.
+func hostAllowed(u *url.URL) bool {
+	if len(allowedHostSet) == 0 {
+		return true
+	}
+	return allowedHostSet[strings.ToLower(u.Host)] || allowedHostSet[strings.ToLower(u.Hostname())]
+}
+
+// allowedHostsTransport fails every request to a host off --allowed-hosts,
+// whichever code path issued it.
+type allowedHostsTransport struct {
+	next http.RoundTripper
+}
+
+func (t allowedHostsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !hostAllowed(req.URL) {
+		return nil, fmt.Errorf("request to %v refused, host %v is not in --allowed-hosts", req.URL, req.URL.Host)
+	}
+	return t.next.RoundTrip(req)
+}
+
+// noCacheTransport asks caching proxies and CDNs in front of the remote to
+// revalidate with the origin, so purged artifacts aren't reported present.
+type noCacheTransport struct {
+	next http.RoundTripper
+}
+
+func (t noCacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Cache-Control", "no-cache")
+	req.Header.Set("Pragma", "no-cache")
+	return t.next.RoundTrip(req)
+}
+
+// redactedHeaders are never dumped, whatever credentials they carry.
+var redactedHeaders = map[string]bool{"Authorization": true, "Proxy-Authorization": true, "Cookie": true, "Set-Cookie": true}
+
+// dumpedResponseHeaders are the response headers --dump-requests shows, the
+// ones telling why an artifact was answered the way it was.
+var dumpedResponseHeaders = []string{"Content-Length", "Content-Type", "Content-Range", "Location", "ETag", "Last-Modified", "Retry-After", "Server", "X-Checksum-Sha1"}
+
+// dumpTransport logs every request line with its headers and the status and
+// key headers of its response, for --dump-requests. Credentials are redacted,
+// from the headers as well as from the URL.
+type dumpTransport struct {
+	next http.RoundTripper
+}
+
+func (t dumpTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	headers := make([]string, 0, len(req.Header))
+	for _, name := range sortedKeys(req.Header) {
+		value := strings.Join(req.Header[name], ", ")
+		if redactedHeaders[http.CanonicalHeaderKey(name)] {
+			value = "REDACTED"
+		}
+		headers = append(headers, name+": "+value)
+	}
+	log.Printf("Request: %v %v %v [%v]", req.Method, req.URL.Redacted(), req.Proto, strings.Join(headers, "; "))
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		log.Printf("Response: %v %v failed: %v", req.Method, req.URL.Redacted(), err)
+		return resp, err
+	}
+	headers = headers[:0]
+	for _, name := range dumpedResponseHeaders {
+		if value := resp.Header.Get(name); value != "" {
+			headers = append(headers, name+": "+value)
+		}
+	}
+	log.Printf("Response: %v %v %v %v [%v]", req.Method, req.URL.Redacted(), resp.Proto, resp.Status, strings.Join(headers, "; "))
+	return resp, nil
+}
+
+// bytesTransferred counts the response body bytes read from the remotes, by
+// sidecar fetches, content checks, ranged probes and metadata lookups alike.
+var bytesTransferred int64
+
+// countingTransport feeds bytesTransferred from every response body.
+type countingTransport struct {
+	next http.RoundTripper
+}
+
+func (t countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err == nil && resp.Body != nil {
+		resp.Body = countingBody{resp.Body}
+	}
+	return resp, err
+}
+
+type countingBody struct {
+	io.ReadCloser
+}
+
+func (b countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	atomic.AddInt64(&bytesTransferred, int64(n))
+	return n, err
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// writeClientCertificate writes a self-signed client certificate and its key
+// to dir and returns their files along with the certificate.
+func writeClientCertificate(t *testing.T, dir string) (string, string, *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "nexus_crawler"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client.key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile, certificate
+}
+
+// trustServer makes client trust the certificate of the httptest server.
+func trustServer(client *http.Client, server *httptest.Server) {
+	tr := client.Transport.(countingTransport).next.(*http.Transport)
+	if tr.TLSClientConfig == nil {
+		tr.TLSClientConfig = &tls.Config{}
+	}
+	tr.TLSClientConfig.RootCAs = x509.NewCertPool()
+	tr.TLSClientConfig.RootCAs.AddCert(server.Certificate())
+}
+
+func TestClientCertificateMutualTLS(t *testing.T) {
+	resetRun(t)
+	certFile, keyFile, certificate := writeClientCertificate(t, t.TempDir())
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: x509.NewCertPool()}
+	server.TLS.ClientCAs.AddCert(certificate)
+	server.StartTLS()
+	defer server.Close()
+
+	client := newHTTPClient()
+	trustServer(client, server)
+	if resp, err := client.Get(server.URL); err == nil {
+		resp.Body.Close()
+		t.Fatal("the server accepted a client without certificate")
+	}
+
+	*clientCert, *clientKey = certFile, keyFile
+	if err := loadClientCertificate(); err != nil {
+		t.Fatal(err)
+	}
+	client = newHTTPClient()
+	trustServer(client, server)
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status %v with the client certificate", resp.Status)
+	}
+}
+
+func TestClientCertificateNeedsKey(t *testing.T) {
+	resetRun(t)
+	certFile, _, _ := writeClientCertificate(t, t.TempDir())
+	*clientCert = certFile
+	if err := loadClientCertificate(); err == nil {
+		t.Error("--client-cert without --client-key was accepted")
+	}
+	*clientKey = certFile
+	if err := loadClientCertificate(); err == nil {
+		t.Error("a certificate as --client-key was accepted")
+	}
+}
+
+func TestHTTP2Negotiation(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+	for enabled, want := range map[bool]string{true: "HTTP/2.0", false: "HTTP/1.1"} {
+		resetRun(t)
+		*http2 = enabled
+		client := newHTTPClient()
+		trustServer(client, server)
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.Proto != want {
+			t.Errorf("--http2=%v negotiated %v, want %v", enabled, resp.Proto, want)
+		}
+	}
+}
+
+func TestDialTimeout(t *testing.T) {
+	resetRun(t)
+	*dialTimeout = 100 * time.Millisecond
+	start := time.Now()
+	// A non-routable address, the connection attempt hangs until the timeout.
+	resp, err := newHTTPClient().Get("http://10.255.255.1:81/")
+	if err == nil {
+		resp.Body.Close()
+		t.Skip("10.255.255.1 is routable here")
+	}
+	if !isTimeout(err) {
+		t.Skipf("10.255.255.1 doesn't hang here: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("--dial-timeout 100ms fired after %v", elapsed)
+	}
+}
+
+func TestTLSHandshakeTimeout(t *testing.T) {
+	resetRun(t)
+	// A server accepting connections but never answering the handshake.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	*tlsHandshakeTimeout = 100 * time.Millisecond
+	start := time.Now()
+	resp, err := newHTTPClient().Get("https://" + listener.Addr().String() + "/")
+	if err == nil {
+		resp.Body.Close()
+		t.Fatal("the handshake succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("--tls-handshake-timeout 100ms fired after %v: %v", elapsed, err)
+	}
+}
+
+func TestNoCacheSetsHeaders(t *testing.T) {
+	var cacheControl, pragma string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cacheControl, pragma = r.Header.Get("Cache-Control"), r.Header.Get("Pragma")
+	}))
+	defer server.Close()
+	for enabled, want := range map[bool]string{true: "no-cache", false: ""} {
+		resetRun(t)
+		*noCache = enabled
+		resp, err := newHTTPClient().Head(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if cacheControl != want || pragma != want {
+			t.Errorf("--no-cache=%v sent Cache-Control %q and Pragma %q, want %q", enabled, cacheControl, pragma, want)
+		}
+	}
+}
+
+func TestProxyCredentials(t *testing.T) {
+	want := "Basic " + base64.StdEncoding.EncodeToString([]byte("crawler:s3cret"))
+	var proxied []string
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Proxy-Authorization") != want {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		proxied = append(proxied, r.URL.String())
+	}))
+	defer stub.Close()
+	for _, test := range []struct {
+		user, password string
+		code           int
+	}{
+		{"", "", http.StatusProxyAuthRequired},
+		{"crawler", "wrong", http.StatusProxyAuthRequired},
+		{"crawler", "s3cret", http.StatusOK},
+	} {
+		resetRun(t)
+		*proxy, *proxyUser, *proxyPassword = stub.URL, test.user, test.password
+		resp, err := newHTTPClient().Head("http://nexus.example/ga/org/e/lib/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.code {
+			t.Errorf("--proxy-user %q --proxy-password %q answered %v, want %v", test.user, test.password, resp.StatusCode, test.code)
+		}
+	}
+	if len(proxied) != 1 || proxied[0] != "http://nexus.example/ga/org/e/lib/" {
+		t.Errorf("the proxy forwarded %v", proxied)
+	}
+
+	for _, test := range []struct{ proxy, user, password string }{
+		{"proxy:3128", "", ""},
+		{"", "", "s3cret"},
+		{"", "dom:crawler", "s3cret"},
+	} {
+		resetRun(t)
+		*proxy, *proxyUser, *proxyPassword = test.proxy, test.user, test.password
+		if err := validateProxy(); err == nil {
+			t.Errorf("validateProxy accepted --proxy %q --proxy-user %q --proxy-password %q", test.proxy, test.user, test.password)
+		}
+	}
+}
+
+func TestAllowedHostsBlockRedirects(t *testing.T) {
+	var escaped int64
+	elsewhere := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&escaped, 1)
+	}))
+	defer elsewhere.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/lib-1.0.jar" {
+			http.Redirect(w, r, elsewhere.URL+"/lib-1.0.jar", http.StatusFound)
+		}
+	}))
+	defer server.Close()
+	resetRun(t)
+	*allowedHosts = strings.TrimPrefix(server.URL, "http://")
+	nexusRoots = stringList{server.URL}
+	if err := parseAllowedHosts(); err != nil {
+		t.Fatal(err)
+	}
+	client := newHTTPClient()
+	resp, err := client.Head(server.URL + "/lib-1.0.pom")
+	if err != nil {
+		t.Fatalf("a request to an allowed host failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp, err := client.Head(server.URL + "/lib-1.0.jar"); err == nil {
+		resp.Body.Close()
+		t.Error("the redirect to a host off --allowed-hosts was followed")
+	}
+	if resp, err := client.Head(elsewhere.URL + "/lib-1.0.jar"); err == nil {
+		resp.Body.Close()
+		t.Error("a request to a host off --allowed-hosts was sent")
+	}
+	if escaped != 0 {
+		t.Errorf("%v requests reached the host off --allowed-hosts", escaped)
+	}
+
+	resetRun(t)
+	*allowedHosts = "nexus.example"
+	nexusRoots = stringList{server.URL}
+	if err := parseAllowedHosts(); err == nil {
+		t.Error("a --nexus-root off --allowed-hosts was accepted")
+	}
+}
+
+func TestDumpRequestsRedactsCredentials(t *testing.T) {
+	resetRun(t)
+	*dumpRequests, *noCache = true, true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"abc"`)
+		w.Header().Set("Set-Cookie", "session=t0ken")
+	}))
+	defer server.Close()
+	var dump bytes.Buffer
+	log.SetOutput(&dump)
+	defer log.SetOutput(os.Stderr)
+	req, err := http.NewRequest(http.MethodHead, strings.Replace(server.URL, "http://", "http://crawler:s3cret@", 1)+"/org/e/lib/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer t0ken")
+	req.Header.Set("Cookie", "session=t0ken")
+	resp, err := newHTTPClient().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	output := dump.String()
+	if strings.Contains(output, "s3cret") || strings.Contains(output, "t0ken") {
+		t.Errorf("credentials dumped:\n%v", output)
+	}
+	for _, want := range []string{"Request: HEAD http://crawler:xxxxx@", "Authorization: REDACTED", "Cookie: REDACTED",
+		"Cache-Control: no-cache", "Response: HEAD", "200 OK", `ETag: "abc"`} {
+		if !strings.Contains(output, want) {
+			t.Errorf("dump lacks %q:\n%v", want, output)
+		}
+	}
+}